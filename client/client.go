@@ -28,9 +28,15 @@ type PortainerClient interface {
 	// Get endpoints
 	EndpointList() ([]portainer.Endpoint, error)
 
+	// Update endpoint
+	EndpointUpdate(options EndpointUpdateOptions) (endpoint portainer.Endpoint, err error)
+
 	// Get endpoint groups
 	EndpointGroupList() ([]portainer.EndpointGroup, error)
 
+	// Update endpoint group
+	EndpointGroupUpdate(options EndpointGroupUpdateOptions) (endpointGroup portainer.EndpointGroup, err error)
+
 	// Get stacks, optionally filtered by swarmId and endpointId
 	StackList(options StackListOptions) ([]portainer.Stack, error)
 
@@ -49,6 +55,27 @@ type PortainerClient interface {
 	// Get stack file content
 	StackFileInspect(stackID portainer.StackID) (content string, err error)
 
+	// Get edge groups
+	EdgeGroupList() ([]EdgeGroup, error)
+
+	// Get edge stacks
+	EdgeStackList() ([]EdgeStack, error)
+
+	// Get edge stack
+	EdgeStackInspect(edgeStackID EdgeStackID) (EdgeStack, error)
+
+	// Create edge stack
+	EdgeStackCreate(options EdgeStackCreateOptions) (edgeStack EdgeStack, err error)
+
+	// Update edge stack
+	EdgeStackUpdate(options EdgeStackUpdateOptions) (edgeStack EdgeStack, err error)
+
+	// Delete edge stack
+	EdgeStackDelete(edgeStackID EdgeStackID) error
+
+	// Get edge stack file content
+	EdgeStackFileInspect(edgeStackID EdgeStackID) (content string, err error)
+
 	// Get endpoint Docker info
 	EndpointDockerInfo(endpointID portainer.EndpointID) (info map[string]interface{}, err error)
 
@@ -76,6 +103,12 @@ type PortainerClient interface {
 	// UserList retrieves a list of users
 	UserList() (users []portainer.User, err error)
 
+	// TeamList retrieves a list of teams
+	TeamList() (teams []portainer.Team, err error)
+
+	// TemplateList retrieves a list of app templates
+	TemplateList() (templates []portainer.Template, err error)
+
 	// GetUsername returns the user name used by the client
 	GetUsername() string
 
@@ -0,0 +1,55 @@
+package client
+
+import (
+	portainer "github.com/portainer/portainer/api"
+)
+
+// EdgeGroupID represents an edge group identifier
+type EdgeGroupID int
+
+// EdgeGroup represents a group of Edge endpoints
+type EdgeGroup struct {
+	ID           EdgeGroupID `json:"Id"`
+	Name         string
+	Dynamic      bool
+	TagIDs       []portainer.TagID `json:"TagIds"`
+	Endpoints    []portainer.EndpointID
+	PartialMatch bool
+}
+
+// EdgeStackID represents an edge stack identifier
+type EdgeStackID int
+
+// EdgeStackStatusType represents an edge stack deployment status in an endpoint
+type EdgeStackStatusType int
+
+// Edge stack deployment status types
+const (
+	_ EdgeStackStatusType = iota
+	// EdgeStackStatusOk means the edge stack was deployed in the endpoint
+	EdgeStackStatusOk
+	// EdgeStackStatusError means the edge stack deployment failed in the endpoint
+	EdgeStackStatusError
+	// EdgeStackStatusAcknowledged means the endpoint got the edge stack but did not deploy it yet
+	EdgeStackStatusAcknowledged
+)
+
+// EdgeStackStatus represents an edge stack deployment status in an endpoint
+type EdgeStackStatus struct {
+	Type       EdgeStackStatusType
+	Error      string
+	EndpointID portainer.EndpointID
+}
+
+// EdgeStack represents a stack deployed in the endpoints of one or more edge groups
+type EdgeStack struct {
+	ID           EdgeStackID `json:"Id"`
+	Name         string
+	Status       map[portainer.EndpointID]EdgeStackStatus
+	CreationDate int64
+	EdgeGroups   []EdgeGroupID
+	ProjectPath  string
+	EntryPoint   string
+	Version      int
+	Prune        bool
+}
@@ -0,0 +1,10 @@
+package client
+
+import (
+	"net/http"
+)
+
+func (n *portainerClientImp) EdgeGroupList() (edgeGroups []EdgeGroup, err error) {
+	err = n.DoJSONWithToken("edge_groups", http.MethodGet, http.Header{}, nil, &edgeGroups)
+	return
+}
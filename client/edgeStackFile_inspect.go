@@ -0,0 +1,24 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// EdgeStackFileInspectResponse represents the body of a response for a request to GET /edge_stacks/{id}/file
+type EdgeStackFileInspectResponse struct {
+	StackFileContent string
+}
+
+func (n *portainerClientImp) EdgeStackFileInspect(edgeStackID EdgeStackID) (content string, err error) {
+	var respBody EdgeStackFileInspectResponse
+
+	err = n.DoJSONWithToken(fmt.Sprintf("edge_stacks/%d/file", edgeStackID), http.MethodGet, http.Header{}, nil, &respBody)
+	if err != nil {
+		return
+	}
+
+	content = respBody.StackFileContent
+
+	return
+}
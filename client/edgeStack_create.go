@@ -0,0 +1,30 @@
+package client
+
+import (
+	"net/http"
+)
+
+// EdgeStackCreateOptions represents options passed to PortainerClient.EdgeStackCreate()
+type EdgeStackCreateOptions struct {
+	Name             string
+	StackFileContent string
+	EdgeGroups       []EdgeGroupID
+}
+
+// EdgeStackCreateRequest represents the body of a request to POST /edge_stacks
+type EdgeStackCreateRequest struct {
+	Name             string
+	StackFileContent string
+	EdgeGroups       []EdgeGroupID
+}
+
+func (n *portainerClientImp) EdgeStackCreate(options EdgeStackCreateOptions) (edgeStack EdgeStack, err error) {
+	reqBody := EdgeStackCreateRequest{
+		Name:             options.Name,
+		StackFileContent: options.StackFileContent,
+		EdgeGroups:       options.EdgeGroups,
+	}
+
+	err = n.DoJSONWithToken("edge_stacks?method=string", http.MethodPost, http.Header{}, &reqBody, &edgeStack)
+	return
+}
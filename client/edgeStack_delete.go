@@ -0,0 +1,11 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+)
+
+func (n *portainerClientImp) EdgeStackDelete(edgeStackID EdgeStackID) (err error) {
+	err = n.DoJSONWithToken(fmt.Sprintf("edge_stacks/%d", edgeStackID), http.MethodDelete, http.Header{}, nil, nil)
+	return
+}
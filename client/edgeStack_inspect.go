@@ -0,0 +1,11 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+)
+
+func (n *portainerClientImp) EdgeStackInspect(edgeStackID EdgeStackID) (edgeStack EdgeStack, err error) {
+	err = n.DoJSONWithToken(fmt.Sprintf("edge_stacks/%d", edgeStackID), http.MethodGet, http.Header{}, nil, &edgeStack)
+	return
+}
@@ -0,0 +1,10 @@
+package client
+
+import (
+	"net/http"
+)
+
+func (n *portainerClientImp) EdgeStackList() (edgeStacks []EdgeStack, err error) {
+	err = n.DoJSONWithToken("edge_stacks", http.MethodGet, http.Header{}, nil, &edgeStacks)
+	return
+}
@@ -0,0 +1,35 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// EdgeStackUpdateOptions represents options passed to PortainerClient.EdgeStackUpdate()
+type EdgeStackUpdateOptions struct {
+	EdgeStack        EdgeStack
+	StackFileContent string
+	EdgeGroups       []EdgeGroupID
+	Prune            bool
+}
+
+// EdgeStackUpdateRequest represents the body of a request to PUT /edge_stacks/{id}
+type EdgeStackUpdateRequest struct {
+	StackFileContent string
+	Version          int
+	Prune            bool
+	EdgeGroups       []EdgeGroupID
+}
+
+func (n *portainerClientImp) EdgeStackUpdate(options EdgeStackUpdateOptions) (edgeStack EdgeStack, err error) {
+	reqBody := EdgeStackUpdateRequest{
+		StackFileContent: options.StackFileContent,
+		// Bumping the version makes the endpoints redeploy the edge stack
+		Version:    options.EdgeStack.Version + 1,
+		Prune:      options.Prune,
+		EdgeGroups: options.EdgeGroups,
+	}
+
+	err = n.DoJSONWithToken(fmt.Sprintf("edge_stacks/%d", options.EdgeStack.ID), http.MethodPut, http.Header{}, &reqBody, &edgeStack)
+	return
+}
@@ -0,0 +1,33 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+
+	portainer "github.com/portainer/portainer/api"
+)
+
+// EndpointGroupUpdateOptions represents options passed to PortainerClient.EndpointGroupUpdate()
+type EndpointGroupUpdateOptions struct {
+	ID portainer.EndpointGroupID
+	// UserAccessPolicies are the users authorized to access the endpoint group. Left unchanged if nil.
+	UserAccessPolicies portainer.UserAccessPolicies
+	// TeamAccessPolicies are the teams authorized to access the endpoint group. Left unchanged if nil.
+	TeamAccessPolicies portainer.TeamAccessPolicies
+}
+
+// EndpointGroupUpdateRequest represents the body of a request to PUT /endpoint_groups/{id}
+type EndpointGroupUpdateRequest struct {
+	UserAccessPolicies portainer.UserAccessPolicies
+	TeamAccessPolicies portainer.TeamAccessPolicies
+}
+
+func (n *portainerClientImp) EndpointGroupUpdate(options EndpointGroupUpdateOptions) (endpointGroup portainer.EndpointGroup, err error) {
+	reqBody := EndpointGroupUpdateRequest{
+		UserAccessPolicies: options.UserAccessPolicies,
+		TeamAccessPolicies: options.TeamAccessPolicies,
+	}
+
+	err = n.DoJSONWithToken(fmt.Sprintf("endpoint_groups/%v", options.ID), http.MethodPut, http.Header{}, &reqBody, &endpointGroup)
+	return
+}
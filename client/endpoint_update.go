@@ -0,0 +1,33 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+
+	portainer "github.com/portainer/portainer/api"
+)
+
+// EndpointUpdateOptions represents options passed to PortainerClient.EndpointUpdate()
+type EndpointUpdateOptions struct {
+	ID portainer.EndpointID
+	// UserAccessPolicies are the users authorized to access the endpoint. Left unchanged if nil.
+	UserAccessPolicies portainer.UserAccessPolicies
+	// TeamAccessPolicies are the teams authorized to access the endpoint. Left unchanged if nil.
+	TeamAccessPolicies portainer.TeamAccessPolicies
+}
+
+// EndpointUpdateRequest represents the body of a request to PUT /endpoints/{id}
+type EndpointUpdateRequest struct {
+	UserAccessPolicies portainer.UserAccessPolicies
+	TeamAccessPolicies portainer.TeamAccessPolicies
+}
+
+func (n *portainerClientImp) EndpointUpdate(options EndpointUpdateOptions) (endpoint portainer.Endpoint, err error) {
+	reqBody := EndpointUpdateRequest{
+		UserAccessPolicies: options.UserAccessPolicies,
+		TeamAccessPolicies: options.TeamAccessPolicies,
+	}
+
+	err = n.DoJSONWithToken(fmt.Sprintf("endpoints/%v", options.ID), http.MethodPut, http.Header{}, &reqBody, &endpoint)
+	return
+}
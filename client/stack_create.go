@@ -12,15 +12,26 @@ type StackCreateComposeOptions struct {
 	StackName            string
 	EnvironmentVariables []portainer.Pair
 	StackFileContent     string
-	EndpointID           portainer.EndpointID
+	// Repository is used instead of StackFileContent when set
+	Repository *StackCreateRepository
+	EndpointID portainer.EndpointID
+}
+
+// StackCreateRepository represents a Git repository holding a stack file,
+// like the ones referenced by stack app templates
+type StackCreateRepository struct {
+	URL           string
+	StackFilePath string
 }
 
 // StackCreateRequest represents the body of a request to POST /stacks
 type StackCreateRequest struct {
-	Name             string
-	SwarmID          string
-	StackFileContent string
-	Env              []portainer.Pair `json:",omitempty"`
+	Name                        string
+	SwarmID                     string
+	StackFileContent            string
+	RepositoryURL               string           `json:",omitempty"`
+	ComposeFilePathInRepository string           `json:",omitempty"`
+	Env                         []portainer.Pair `json:",omitempty"`
 }
 
 // StackCreateSwarmOptions represents options passed to PortainerClient.StackCreateSwarm()
@@ -28,8 +39,10 @@ type StackCreateSwarmOptions struct {
 	StackName            string
 	EnvironmentVariables []portainer.Pair
 	StackFileContent     string
-	SwarmClusterID       string
-	EndpointID           portainer.EndpointID
+	// Repository is used instead of StackFileContent when set
+	Repository     *StackCreateRepository
+	SwarmClusterID string
+	EndpointID     portainer.EndpointID
 }
 
 func (n *portainerClientImp) StackCreateCompose(options StackCreateComposeOptions) (stack portainer.Stack, err error) {
@@ -38,8 +51,9 @@ func (n *portainerClientImp) StackCreateCompose(options StackCreateComposeOption
 		Env:              options.EnvironmentVariables,
 		StackFileContent: options.StackFileContent,
 	}
+	method := setStackCreateRequestRepository(&reqBody, options.Repository)
 
-	err = n.DoJSONWithToken(fmt.Sprintf("stacks?type=%v&method=%s&endpointId=%v", 2, "string", options.EndpointID), http.MethodPost, http.Header{}, &reqBody, &stack)
+	err = n.DoJSONWithToken(fmt.Sprintf("stacks?type=%v&method=%s&endpointId=%v", 2, method, options.EndpointID), http.MethodPost, http.Header{}, &reqBody, &stack)
 	return
 }
 
@@ -50,7 +64,19 @@ func (n *portainerClientImp) StackCreateSwarm(options StackCreateSwarmOptions) (
 		SwarmID:          options.SwarmClusterID,
 		StackFileContent: options.StackFileContent,
 	}
+	method := setStackCreateRequestRepository(&reqBody, options.Repository)
 
-	err = n.DoJSONWithToken(fmt.Sprintf("stacks?type=%v&method=%s&endpointId=%v", 1, "string", options.EndpointID), http.MethodPost, http.Header{}, &reqBody, &stack)
+	err = n.DoJSONWithToken(fmt.Sprintf("stacks?type=%v&method=%s&endpointId=%v", 1, method, options.EndpointID), http.MethodPost, http.Header{}, &reqBody, &stack)
 	return
 }
+
+// setStackCreateRequestRepository sets the repository fields of a stack
+// creation request, and returns the creation method to use
+func setStackCreateRequestRepository(reqBody *StackCreateRequest, repository *StackCreateRepository) (method string) {
+	if repository == nil {
+		return "string"
+	}
+	reqBody.RepositoryURL = repository.URL
+	reqBody.ComposeFilePathInRepository = repository.StackFilePath
+	return "repository"
+}
@@ -0,0 +1,12 @@
+package client
+
+import (
+	"net/http"
+
+	portainer "github.com/portainer/portainer/api"
+)
+
+func (n *portainerClientImp) TeamList() (teams []portainer.Team, err error) {
+	err = n.DoJSONWithToken("teams", http.MethodGet, http.Header{}, nil, &teams)
+	return
+}
@@ -0,0 +1,12 @@
+package client
+
+import (
+	"net/http"
+
+	portainer "github.com/portainer/portainer/api"
+)
+
+func (n *portainerClientImp) TemplateList() (templates []portainer.Template, err error) {
+	err = n.DoJSONWithToken("templates", http.MethodGet, http.Header{}, nil, &templates)
+	return
+}
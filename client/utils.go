@@ -15,3 +15,31 @@ func GetTranslatedStackType(t portainer.StackType) string {
 		return ""
 	}
 }
+
+// GetTranslatedTemplateType returns a template's Type field (int) translated to it's human readable form (string)
+func GetTranslatedTemplateType(t portainer.TemplateType) string {
+	switch t {
+	case portainer.ContainerTemplate:
+		return "container"
+	case portainer.SwarmStackTemplate:
+		return "swarm"
+	case portainer.ComposeStackTemplate:
+		return "compose"
+	default:
+		return ""
+	}
+}
+
+// GetTranslatedEdgeStackStatusType returns an edge stack status' Type field (int) translated to it's human readable form (string)
+func GetTranslatedEdgeStackStatusType(t EdgeStackStatusType) string {
+	switch t {
+	case EdgeStackStatusOk:
+		return "ok"
+	case EdgeStackStatusError:
+		return "error"
+	case EdgeStackStatusAcknowledged:
+		return "acknowledged"
+	default:
+		return "pending"
+	}
+}
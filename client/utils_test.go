@@ -44,3 +44,93 @@ func TestGetTranslatedStackType(t *testing.T) {
 		})
 	}
 }
+
+func TestGetTranslatedTemplateType(t *testing.T) {
+	type args struct {
+		t portainer.TemplateType
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{
+			name: "container template type",
+			args: args{
+				t: portainer.ContainerTemplate,
+			},
+			want: "container",
+		},
+		{
+			name: "swarm stack template type",
+			args: args{
+				t: portainer.SwarmStackTemplate,
+			},
+			want: "swarm",
+		},
+		{
+			name: "compose stack template type",
+			args: args{
+				t: portainer.ComposeStackTemplate,
+			},
+			want: "compose",
+		},
+		{
+			name: "unknown template type",
+			args: args{
+				t: 100,
+			},
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, GetTranslatedTemplateType(tt.args.t))
+		})
+	}
+}
+
+func TestGetTranslatedEdgeStackStatusType(t *testing.T) {
+	type args struct {
+		t EdgeStackStatusType
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{
+			name: "ok status type",
+			args: args{
+				t: EdgeStackStatusOk,
+			},
+			want: "ok",
+		},
+		{
+			name: "error status type",
+			args: args{
+				t: EdgeStackStatusError,
+			},
+			want: "error",
+		},
+		{
+			name: "acknowledged status type",
+			args: args{
+				t: EdgeStackStatusAcknowledged,
+			},
+			want: "acknowledged",
+		},
+		{
+			name: "unknown status type",
+			args: args{
+				t: 100,
+			},
+			want: "pending",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, GetTranslatedEdgeStackStatusType(tt.args.t))
+		})
+	}
+}
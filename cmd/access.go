@@ -0,0 +1,15 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// accessCmd represents the access command
+var accessCmd = &cobra.Command{
+	Use:   "access",
+	Short: "Manage access control across resources",
+}
+
+func init() {
+	rootCmd.AddCommand(accessCmd)
+}
@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/template"
+
+	"github.com/greenled/portainer-stack-utils/common"
+	portainer "github.com/portainer/portainer/api"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// accessApplyCmd represents the access apply command
+var accessApplyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Create, update or remove access controls to make resources match a policy",
+	Example: `  Print the changes needed to make resources match a policy:
+  psu access apply --policy access.yml --dry-run
+
+  Apply a policy:
+  psu access apply --policy access.yml`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		policy, err := common.LoadAccessPolicy(viper.GetString("access.apply.policy"))
+		common.CheckError(err)
+
+		var endpoints []portainer.Endpoint
+		if endpointNames := policy.Endpoints(); endpointNames == nil {
+			portainerClient, err := common.GetClient()
+			common.CheckError(err)
+
+			logrus.Debug("Getting endpoints")
+			endpoints, err = portainerClient.EndpointList()
+			common.CheckError(err)
+		} else {
+			for _, endpointName := range endpointNames {
+				endpoint, endpointRetrievalErr := common.GetEndpointByName(endpointName)
+				common.CheckError(endpointRetrievalErr)
+				endpoints = append(endpoints, endpoint)
+			}
+		}
+
+		var dockerEndpoints []portainer.Endpoint
+		for _, endpoint := range endpoints {
+			if endpoint.Type == portainer.AzureEnvironment {
+				logrus.WithFields(logrus.Fields{
+					"endpoint": endpoint.Name,
+				}).Debug("Skipping Azure endpoint")
+				continue
+			}
+			dockerEndpoints = append(dockerEndpoints, endpoint)
+		}
+
+		logrus.Debug("Computing access control changes")
+		changes, err := common.ComputeAccessPolicyChanges(policy, dockerEndpoints)
+		common.CheckError(err)
+
+		if len(changes) == 0 {
+			logrus.Info("Resources already match the policy")
+			return
+		}
+
+		err = printAccessPolicyChanges(changes, viper.GetString("access.apply.format"))
+		common.CheckError(err)
+
+		if viper.GetBool("access.apply.dry-run") {
+			return
+		}
+
+		failedChanges := 0
+		for _, change := range changes {
+			logrus.WithFields(logrus.Fields{
+				string(change.Type): change.Name,
+				"endpoint":          change.Endpoint,
+				"action":            change.Action,
+			}).Debug("Applying access control change")
+			err := common.ApplyAccessPolicyChange(change)
+			if err != nil {
+				logrus.WithFields(logrus.Fields{
+					string(change.Type): change.Name,
+					"endpoint":          change.Endpoint,
+					"action":            change.Action,
+					"message":           err.Error(),
+				}).Error("Access control change failed")
+				failedChanges++
+			}
+		}
+
+		logrus.Info(fmt.Sprintf("%d change(s) applied, %d failed", len(changes)-failedChanges, failedChanges))
+
+		if failedChanges > 0 {
+			logrus.Fatal("some resources could not be reconciled")
+		}
+	},
+}
+
+// printAccessPolicyChanges prints access policy changes in a given format
+func printAccessPolicyChanges(changes []common.AccessPolicyChange, format string) (err error) {
+	var changesInfo []common.AccessPolicyChangeInfo
+	for _, change := range changes {
+		changesInfo = append(changesInfo, change.AccessPolicyChangeInfo)
+	}
+
+	switch format {
+	case "table":
+		// Print changes in a table format
+		writer, err := common.NewTabWriter([]string{
+			"ACTION",
+			"ENDPOINT",
+			"TYPE",
+			"ID",
+			"NAME",
+			"FROM",
+			"TO",
+			"RULE",
+		})
+		if err != nil {
+			return err
+		}
+		for _, c := range changesInfo {
+			_, err = fmt.Fprintln(writer, fmt.Sprintf(
+				"%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d",
+				c.Action,
+				c.Endpoint,
+				c.Type,
+				c.ID,
+				c.Name,
+				c.From,
+				c.To,
+				c.Rule,
+			))
+			if err != nil {
+				return err
+			}
+		}
+		return writer.Flush()
+	case "json":
+		// Print changes in a json format
+		changesJSONBytes, err := json.Marshal(changesInfo)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(changesJSONBytes))
+	default:
+		// Print changes in a custom format
+		template, err := template.New("accessPolicyChangeTpl").Parse(format)
+		if err != nil {
+			return err
+		}
+		for _, c := range changesInfo {
+			err = template.Execute(os.Stdout, c)
+			if err != nil {
+				return err
+			}
+			fmt.Println()
+		}
+	}
+	return
+}
+
+func init() {
+	accessCmd.AddCommand(accessApplyCmd)
+
+	accessApplyCmd.Flags().Bool("dry-run", false, "Print the changes without applying them.")
+	accessApplyCmd.Flags().String("format", "table", `Output format for the changes. Can be "table", "json" or a Go template.`)
+	accessApplyCmd.Flags().String("policy", "access.yml", "Path to a policy file describing the desired access control.")
+	viper.BindPFlag("access.apply.dry-run", accessApplyCmd.Flags().Lookup("dry-run"))
+	viper.BindPFlag("access.apply.format", accessApplyCmd.Flags().Lookup("format"))
+	viper.BindPFlag("access.apply.policy", accessApplyCmd.Flags().Lookup("policy"))
+
+	accessApplyCmd.SetUsageTemplate(accessApplyCmd.UsageTemplate() + common.GetFormatHelp(common.AccessPolicyChangeInfo{}) + common.AccessPolicyHelp)
+}
@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/greenled/portainer-stack-utils/common"
+	portainer "github.com/portainer/portainer/api"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// accessAuditCmd represents the access audit command
+var accessAuditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Report resources with public, administrators only or orphaned access control",
+	Example: `  Audit resources in all endpoints:
+  psu access audit
+
+  Audit resources in an endpoint, including the ones without findings:
+  psu access audit --endpoint primary --all
+
+  Print public resources:
+  psu access audit --format "{{ if eq .Access \"public\" }}{{ .Endpoint }} {{ .Type }} {{ .Name }}{{ end }}"`,
+	Run: func(cmd *cobra.Command, args []string) {
+		portainerClient, err := common.GetClient()
+		common.CheckError(err)
+
+		var endpoints []portainer.Endpoint
+		if endpointName := viper.GetString("access.audit.endpoint"); endpointName == "" {
+			logrus.Debug("Getting endpoints")
+			endpoints, err = portainerClient.EndpointList()
+			common.CheckError(err)
+		} else {
+			endpoint, endpointRetrievalErr := common.GetEndpointByName(endpointName)
+			common.CheckError(endpointRetrievalErr)
+			endpoints = []portainer.Endpoint{endpoint}
+		}
+
+		logrus.Debug("Getting users")
+		users, err := portainerClient.UserList()
+		common.CheckError(err)
+
+		logrus.Debug("Getting teams")
+		teams, err := portainerClient.TeamList()
+		common.CheckError(err)
+
+		var entries []common.AccessAuditEntry
+		for _, endpoint := range endpoints {
+			if endpoint.Type == portainer.AzureEnvironment {
+				logrus.WithFields(logrus.Fields{
+					"endpoint": endpoint.Name,
+				}).Debug("Skipping Azure endpoint")
+				continue
+			}
+
+			logrus.WithFields(logrus.Fields{
+				"endpoint": endpoint.Name,
+			}).Info("Auditing endpoint")
+			endpointEntries, auditErr := common.AuditEndpointAccessControl(endpoint, users, teams)
+			if auditErr != nil {
+				if viper.GetString("access.audit.endpoint") != "" {
+					common.CheckError(auditErr)
+				}
+				logrus.WithFields(logrus.Fields{
+					"endpoint":     endpoint.Name,
+					"message":      auditErr.Error(),
+					"implications": "Resources in this endpoint will not be audited",
+					"suggestions":  "Check the endpoint is reachable",
+				}).Warning("Could not audit endpoint")
+				continue
+			}
+
+			for _, entry := range endpointEntries {
+				if len(entry.Findings) > 0 || viper.GetBool("access.audit.all") {
+					entries = append(entries, entry)
+				}
+			}
+		}
+
+		switch viper.GetString("access.audit.format") {
+		case "table":
+			// Print audit entries in a table format
+			writer, err := common.NewTabWriter([]string{
+				"ENDPOINT",
+				"TYPE",
+				"ID",
+				"NAME",
+				"ACCESS",
+				"FINDINGS",
+				"DELETED USERS",
+				"DELETED TEAMS",
+			})
+			common.CheckError(err)
+			for _, e := range entries {
+				_, err := fmt.Fprintln(writer, fmt.Sprintf(
+					"%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s",
+					e.Endpoint,
+					e.Type,
+					e.ID,
+					e.Name,
+					e.Access,
+					strings.Join(e.Findings, ","),
+					strings.Replace(strings.Trim(fmt.Sprint(e.DeletedUsers), "[]"), " ", ",", -1),
+					strings.Replace(strings.Trim(fmt.Sprint(e.DeletedTeams), "[]"), " ", ",", -1),
+				))
+				common.CheckError(err)
+			}
+			flushErr := writer.Flush()
+			common.CheckError(flushErr)
+		case "json":
+			// Print audit entries in a json format
+			entriesJSONBytes, err := json.Marshal(entries)
+			common.CheckError(err)
+			fmt.Println(string(entriesJSONBytes))
+		default:
+			// Print audit entries in a custom format
+			template, templateParsingErr := template.New("accessAuditTpl").Parse(viper.GetString("access.audit.format"))
+			common.CheckError(templateParsingErr)
+			for _, e := range entries {
+				templateExecutionErr := template.Execute(os.Stdout, e)
+				common.CheckError(templateExecutionErr)
+				fmt.Println()
+			}
+		}
+	},
+}
+
+func init() {
+	accessCmd.AddCommand(accessAuditCmd)
+
+	accessAuditCmd.Flags().Bool("all", false, "Include resources without findings.")
+	accessAuditCmd.Flags().String("endpoint", "", "Endpoint name. Defaults to all endpoints.")
+	accessAuditCmd.Flags().String("format", "table", `Output format. Can be "table", "json" or a Go template.`)
+	viper.BindPFlag("access.audit.all", accessAuditCmd.Flags().Lookup("all"))
+	viper.BindPFlag("access.audit.endpoint", accessAuditCmd.Flags().Lookup("endpoint"))
+	viper.BindPFlag("access.audit.format", accessAuditCmd.Flags().Lookup("format"))
+
+	accessAuditCmd.SetUsageTemplate(accessAuditCmd.UsageTemplate() + common.GetFormatHelp(common.AccessAuditEntry{}))
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/greenled/portainer-stack-utils/common"
+	portainer "github.com/portainer/portainer/api"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// accessCopyCmd represents the access copy command
+var accessCopyCmd = &cobra.Command{
+	Use:   "copy",
+	Short: "Copy access control from a resource to others",
+	Example: `  Give a stack's service and volume the same access control as the stack:
+  psu access copy --from stack/web --to service/web_api,volume/web_data
+
+  Copy access control between containers in an endpoint:
+  psu access copy --endpoint primary --from container/web_app.1 --to container/web_app.2`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		sourceType, sourceName, err := common.ParseResourceReference(viper.GetString("access.copy.from"))
+		common.CheckError(err)
+
+		targetReferences := viper.GetStringSlice("access.copy.to")
+		if len(targetReferences) == 0 {
+			logrus.WithFields(logrus.Fields{
+				"suggestions": "Use --to flag to set the target resources",
+			}).Fatal("No target resources set")
+		}
+
+		var endpoint portainer.Endpoint
+		if endpointName := viper.GetString("access.copy.endpoint"); endpointName == "" {
+			// Guess endpoint if not set
+			logrus.WithFields(logrus.Fields{
+				"implications": "Command will fail if there is not exactly one endpoint available",
+			}).Warning("Endpoint not set")
+			var endpointRetrievalErr error
+			endpoint, endpointRetrievalErr = common.GetDefaultEndpoint()
+			common.CheckError(endpointRetrievalErr)
+			endpointName = endpoint.Name
+			logrus.WithFields(logrus.Fields{
+				"endpoint": endpointName,
+			}).Debug("Using the only available endpoint")
+		} else {
+			// Get endpoint by name
+			var endpointRetrievalErr error
+			endpoint, endpointRetrievalErr = common.GetEndpointByName(endpointName)
+			common.CheckError(endpointRetrievalErr)
+		}
+
+		logrus.WithFields(logrus.Fields{
+			string(sourceType): sourceName,
+			"endpoint":         endpoint.Name,
+		}).Debug("Getting source access control")
+		source, err := common.ResolveResource(endpoint.ID, sourceType, sourceName)
+		common.CheckError(err)
+		accessControl := common.NewAccessControlFromResourceControl(source.ResourceControl, source.HasAccessControl())
+
+		// Resolve every target before changing any of them
+		var targets []common.DockerResource
+		for _, targetReference := range targetReferences {
+			targetType, targetName, err := common.ParseResourceReference(targetReference)
+			common.CheckError(err)
+			target, err := common.ResolveResource(endpoint.ID, targetType, targetName)
+			common.CheckError(err)
+			targets = append(targets, target)
+		}
+
+		failedTargets := 0
+		for _, target := range targets {
+			change, needed := common.GetAccessPolicyChange(target, accessControl)
+			if !needed {
+				logrus.WithFields(logrus.Fields{
+					string(target.Type): target.Name,
+				}).Info("Access control already set")
+				continue
+			}
+			change.Endpoint = endpoint.Name
+			err := common.ApplyAccessPolicyChange(change)
+			if err != nil {
+				logrus.WithFields(logrus.Fields{
+					string(target.Type): target.Name,
+					"message":           err.Error(),
+				}).Error("Could not set access control")
+				failedTargets++
+				continue
+			}
+			logrus.WithFields(logrus.Fields{
+				string(target.Type): target.Name,
+				"from":              change.From,
+				"to":                change.To,
+			}).Info("Access control set")
+		}
+
+		if failedTargets > 0 {
+			logrus.Fatal(fmt.Sprintf("access control could not be set for %d resource(s)", failedTargets))
+		}
+	},
+}
+
+func init() {
+	accessCmd.AddCommand(accessCopyCmd)
+
+	accessCopyCmd.Flags().String("endpoint", "", "Endpoint name.")
+	accessCopyCmd.Flags().String("from", "", `Resource to copy the access control from, like "stack/web".`)
+	accessCopyCmd.Flags().StringSlice("to", []string{}, `Resources to copy the access control to, like "service/web_api". Can be used several times.`)
+	viper.BindPFlag("access.copy.endpoint", accessCopyCmd.Flags().Lookup("endpoint"))
+	viper.BindPFlag("access.copy.from", accessCopyCmd.Flags().Lookup("from"))
+	viper.BindPFlag("access.copy.to", accessCopyCmd.Flags().Lookup("to"))
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/greenled/portainer-stack-utils/client"
+	"github.com/greenled/portainer-stack-utils/common"
+	portainer "github.com/portainer/portainer/api"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// accessShowCmd represents the access show command
+var accessShowCmd = &cobra.Command{
+	Use:     "show <type> <name>",
+	Short:   "Print access control for a resource",
+	Aliases: []string{"inspect"},
+	Example: `  Print access control for a stack:
+  psu access show stack mystack --endpoint primary
+
+  Print the users with access to a volume:
+  psu access show volume myvolume --format "{{ .Users }}"`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		resourceType := client.ResourceType(args[0])
+		resourceName := args[1]
+
+		validType := false
+		var resourceTypes []string
+		for _, t := range common.AccessControlledResourceTypes {
+			validType = validType || t == resourceType
+			resourceTypes = append(resourceTypes, string(t))
+		}
+		if !validType {
+			logrus.WithFields(logrus.Fields{
+				"type":        resourceType,
+				"suggestions": fmt.Sprintf("use one of %s", strings.Join(resourceTypes, ", ")),
+			}).Fatal("invalid resource type")
+		}
+
+		var endpoint portainer.Endpoint
+		if endpointName := viper.GetString("access.show.endpoint"); endpointName == "" {
+			// Guess endpoint if not set
+			logrus.WithFields(logrus.Fields{
+				"implications": "Command will fail if there is not exactly one endpoint available",
+			}).Warning("Endpoint not set")
+			var endpointRetrievalErr error
+			endpoint, endpointRetrievalErr = common.GetDefaultEndpoint()
+			common.CheckError(endpointRetrievalErr)
+			endpointName = endpoint.Name
+			logrus.WithFields(logrus.Fields{
+				"endpoint": endpointName,
+			}).Debug("Using the only available endpoint")
+		} else {
+			// Get endpoint by name
+			var endpointRetrievalErr error
+			endpoint, endpointRetrievalErr = common.GetEndpointByName(endpointName)
+			common.CheckError(endpointRetrievalErr)
+		}
+
+		logrus.WithFields(logrus.Fields{
+			string(resourceType): resourceName,
+			"endpoint":           endpoint.Name,
+		}).Debug(fmt.Sprintf("Getting %s", resourceType))
+		resource, resourceRetrievalErr := common.ResolveResource(endpoint.ID, resourceType, resourceName)
+		common.CheckError(resourceRetrievalErr)
+
+		logrus.WithFields(logrus.Fields{
+			string(resourceType): resource.ID,
+			"endpoint":           endpoint.Name,
+		}).Debug(fmt.Sprintf("Getting %s access control info", resourceType))
+		resourceControl, accessControlRetrievalErr := common.GetPortainerAccessControl(endpoint.ID, resource.ID, resourceType)
+		if accessControlRetrievalErr != nil && accessControlRetrievalErr != common.ErrAccessControlNotFound {
+			common.CheckError(accessControlRetrievalErr)
+		}
+		info, err := common.GetAccessControlInfo(resource.ID, resourceControl, accessControlRetrievalErr == nil)
+		common.CheckError(err)
+
+		switch viper.GetString("access.show.format") {
+		case "table":
+			// Print access control in a table format
+			writer, err := common.NewTabWriter([]string{
+				strings.ToUpper(string(resourceType)),
+				"ACCESS",
+				"USERS",
+				"TEAMS",
+				"SUB-RESOURCES",
+			})
+			common.CheckError(err)
+			_, err = fmt.Fprintln(writer, fmt.Sprintf(
+				"%s\t%s\t%s\t%s\t%s",
+				info.Resource,
+				info.Access,
+				strings.Join(info.Users, ","),
+				strings.Join(info.Teams, ","),
+				strings.Join(info.SubResources, ","),
+			))
+			common.CheckError(err)
+			flushErr := writer.Flush()
+			common.CheckError(flushErr)
+		case "json":
+			// Print access control in a json format
+			infoJSONBytes, err := json.Marshal(info)
+			common.CheckError(err)
+			fmt.Println(string(infoJSONBytes))
+		default:
+			// Print access control in a custom format
+			template, templateParsingErr := template.New("accessControlTpl").Parse(viper.GetString("access.show.format"))
+			common.CheckError(templateParsingErr)
+			templateExecutionErr := template.Execute(os.Stdout, info)
+			common.CheckError(templateExecutionErr)
+			fmt.Println()
+		}
+	},
+}
+
+func init() {
+	accessCmd.AddCommand(accessShowCmd)
+
+	accessShowCmd.Flags().String("endpoint", "", "Endpoint name.")
+	accessShowCmd.Flags().String("format", "table", `Output format. Can be "table", "json" or a Go template.`)
+	viper.BindPFlag("access.show.endpoint", accessShowCmd.Flags().Lookup("endpoint"))
+	viper.BindPFlag("access.show.format", accessShowCmd.Flags().Lookup("format"))
+
+	accessShowCmd.SetUsageTemplate(accessShowCmd.UsageTemplate() + common.GetFormatHelp(common.AccessControlInfo{}))
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/greenled/portainer-stack-utils/common"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// applyCmd represents the apply command
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Create, update or remove stacks to make them match a manifest",
+	Example: `  Apply psu.yaml manifest, asking for confirmation:
+  psu apply
+
+  Apply a manifest without asking for confirmation, removing stacks not in the manifest:
+  psu apply --manifest stacks.yml --prune-unmanaged --yes`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		m, err := loadManifest(viper.GetString("apply.manifest"))
+		common.CheckError(err)
+
+		steps, err := computePlan(m, viper.GetBool("apply.prune-unmanaged"))
+		common.CheckError(err)
+
+		var pendingSteps []stackPlanStep
+		for _, step := range steps {
+			if step.Action != stackPlanActionNone {
+				pendingSteps = append(pendingSteps, step)
+			}
+		}
+		if len(pendingSteps) == 0 {
+			logrus.Info("Stacks already match the manifest")
+			return
+		}
+
+		if !viper.GetBool("apply.yes") {
+			err = printPlan(pendingSteps, "table")
+			common.CheckError(err)
+
+			confirmed, confirmationErr := common.Confirm(fmt.Sprintf("Apply %d action(s)?", len(pendingSteps)))
+			common.CheckError(confirmationErr)
+			if !confirmed {
+				logrus.WithFields(logrus.Fields{
+					"suggestions": "use --yes flag to skip confirmation",
+				}).Fatal("manifest application not confirmed")
+			}
+		}
+
+		var failedStacks []string
+		for _, step := range pendingSteps {
+			err := executePlanStep(step)
+			if err != nil {
+				logrus.WithFields(logrus.Fields{
+					"stack":    step.Stack,
+					"endpoint": step.Endpoint,
+					"action":   step.Action,
+					"message":  err.Error(),
+				}).Error("Stack action failed")
+				failedStacks = append(failedStacks, step.Stack)
+			}
+		}
+
+		logrus.Info(fmt.Sprintf("%d action(s) applied, %d failed", len(pendingSteps)-len(failedStacks), len(failedStacks)))
+
+		if len(failedStacks) > 0 {
+			logrus.WithFields(logrus.Fields{
+				"stacks": strings.Join(failedStacks, ","),
+			}).Fatal("some stacks could not be reconciled")
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(applyCmd)
+
+	applyCmd.Flags().StringP("manifest", "m", "psu.yaml", "Path to a manifest file describing the stacks.")
+	applyCmd.Flags().Bool("prune-unmanaged", false, "Remove stacks in the manifest endpoints which are not described in the manifest.")
+	applyCmd.Flags().BoolP("yes", "y", false, "Do not ask for confirmation before applying the changes.")
+	viper.BindPFlag("apply.manifest", applyCmd.Flags().Lookup("manifest"))
+	viper.BindPFlag("apply.prune-unmanaged", applyCmd.Flags().Lookup("prune-unmanaged"))
+	viper.BindPFlag("apply.yes", applyCmd.Flags().Lookup("yes"))
+
+	applyCmd.SetUsageTemplate(applyCmd.UsageTemplate() + manifestHelp)
+}
@@ -0,0 +1,15 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// edgeStackCmd represents the edge-stack command
+var edgeStackCmd = &cobra.Command{
+	Use:   "edge-stack",
+	Short: "Manage edge stacks",
+}
+
+func init() {
+	rootCmd.AddCommand(edgeStackCmd)
+}
@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"strings"
+	"time"
+
+	"github.com/greenled/portainer-stack-utils/client"
+	"github.com/greenled/portainer-stack-utils/common"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// edgeStackDeployCmd represents the edge-stack deploy command
+var edgeStackDeployCmd = &cobra.Command{
+	Use:     "deploy <name>",
+	Short:   "Deploy an edge stack",
+	Long:    "Deploy an edge stack in the endpoints of one or more edge groups. The edge stack is created if it does not exist, or updated (and redeployed in every endpoint) if it does.",
+	Aliases: []string{"up", "create"},
+	Example: `  Deploy an edge stack in the endpoints of an edge group:
+  psu edge-stack deploy mystack --stack-file mystack.yml --edge-group stores
+
+  Redeploy an existing edge stack with a new stack file, keeping its edge groups:
+  psu edge-stack deploy mystack --stack-file mystack.yml
+
+  Move an existing edge stack to other edge groups:
+  psu edge-stack deploy mystack --edge-group stores --edge-group warehouses`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		edgeStackName := args[0]
+
+		portainerClient, err := common.GetClient()
+		common.CheckError(err)
+
+		logrus.Debug("Getting edge groups")
+		edgeGroups, edgeGroupsRetrievalErr := portainerClient.EdgeGroupList()
+		common.CheckError(edgeGroupsRetrievalErr)
+
+		var edgeGroupIDs []client.EdgeGroupID
+		if edgeGroupNames := viper.GetStringSlice("edge-stack.deploy.edge-group"); len(edgeGroupNames) > 0 {
+			for _, edgeGroupName := range edgeGroupNames {
+				edgeGroup, edgeGroupRetrievalErr := common.GetEdgeGroupFromListByName(edgeGroups, edgeGroupName)
+				if edgeGroupRetrievalErr == common.ErrEdgeGroupNotFound {
+					logrus.WithFields(logrus.Fields{
+						"edge-group":  edgeGroupName,
+						"suggestions": "list the available edge groups in the Portainer UI",
+					}).Fatal("Edge group not found")
+				}
+				common.CheckError(edgeGroupRetrievalErr)
+				edgeGroupIDs = append(edgeGroupIDs, edgeGroup.ID)
+			}
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"stack": edgeStackName,
+		}).Debug("Getting edge stack")
+		retrievedEdgeStack, edgeStackRetrievalErr := common.GetEdgeStackByName(edgeStackName)
+		if edgeStackRetrievalErr == nil {
+			// We are updating an existing edge stack
+			logrus.WithFields(logrus.Fields{
+				"stack": retrievedEdgeStack.Name,
+			}).Debug("Edge stack found")
+
+			var stackFileContent string
+			if viper.GetString("edge-stack.deploy.stack-file") != "" {
+				var loadingErr error
+				stackFileContent, loadingErr = loadStackFile(viper.GetString("edge-stack.deploy.stack-file"))
+				common.CheckError(loadingErr)
+			} else {
+				var stackFileContentRetrievalErr error
+				stackFileContent, stackFileContentRetrievalErr = portainerClient.EdgeStackFileInspect(retrievedEdgeStack.ID)
+				common.CheckError(stackFileContentRetrievalErr)
+			}
+
+			if len(edgeGroupIDs) == 0 {
+				edgeGroupIDs = retrievedEdgeStack.EdgeGroups
+			}
+
+			logrus.WithFields(logrus.Fields{
+				"stack": retrievedEdgeStack.Name,
+			}).Info("Updating edge stack")
+			startedAt := time.Now()
+			_, err := portainerClient.EdgeStackUpdate(client.EdgeStackUpdateOptions{
+				EdgeStack:        retrievedEdgeStack,
+				StackFileContent: stackFileContent,
+				EdgeGroups:       edgeGroupIDs,
+				Prune:            viper.GetBool("edge-stack.deploy.prune"),
+			})
+			common.Notify(common.NewNotification(common.NotificationActionDeploy, retrievedEdgeStack.Name, strings.Join(getEdgeGroupNames(edgeGroups, edgeGroupIDs), ","), startedAt, err))
+			common.CheckError(err)
+			logrus.WithFields(logrus.Fields{
+				"stack": retrievedEdgeStack.Name,
+			}).Info("Edge stack updated")
+		} else if edgeStackRetrievalErr == common.ErrEdgeStackNotFound {
+			// We are deploying a new edge stack
+			if viper.GetString("edge-stack.deploy.stack-file") == "" {
+				logrus.Fatal(`required flag(s) "stack-file" not set`)
+			}
+			if len(edgeGroupIDs) == 0 {
+				logrus.Fatal(`required flag(s) "edge-group" not set`)
+			}
+			stackFileContent, loadingErr := loadStackFile(viper.GetString("edge-stack.deploy.stack-file"))
+			common.CheckError(loadingErr)
+
+			logrus.WithFields(logrus.Fields{
+				"stack":       edgeStackName,
+				"edge-groups": strings.Join(viper.GetStringSlice("edge-stack.deploy.edge-group"), ","),
+			}).Info("Creating edge stack")
+			startedAt := time.Now()
+			edgeStack, deploymentErr := portainerClient.EdgeStackCreate(client.EdgeStackCreateOptions{
+				Name:             edgeStackName,
+				StackFileContent: stackFileContent,
+				EdgeGroups:       edgeGroupIDs,
+			})
+			common.Notify(common.NewNotification(common.NotificationActionDeploy, edgeStackName, strings.Join(getEdgeGroupNames(edgeGroups, edgeGroupIDs), ","), startedAt, deploymentErr))
+			common.CheckError(deploymentErr)
+			logrus.WithFields(logrus.Fields{
+				"stack": edgeStack.Name,
+				"id":    edgeStack.ID,
+			}).Info("Edge stack created")
+		} else {
+			// Something else happened
+			common.CheckError(edgeStackRetrievalErr)
+		}
+	},
+}
+
+func init() {
+	edgeStackCmd.AddCommand(edgeStackDeployCmd)
+
+	edgeStackDeployCmd.Flags().StringP("stack-file", "c", "", "Path to a file with the content of the stack.")
+	edgeStackDeployCmd.Flags().StringSlice("edge-group", []string{}, "Name of an edge group to deploy the stack to. Can be used several times. Required for new edge stacks.")
+	edgeStackDeployCmd.Flags().Bool("prune", false, "Prune services that are no longer referenced (only available for Swarm endpoints).")
+	viper.BindPFlag("edge-stack.deploy.stack-file", edgeStackDeployCmd.Flags().Lookup("stack-file"))
+	viper.BindPFlag("edge-stack.deploy.edge-group", edgeStackDeployCmd.Flags().Lookup("edge-group"))
+	viper.BindPFlag("edge-stack.deploy.prune", edgeStackDeployCmd.Flags().Lookup("prune"))
+}
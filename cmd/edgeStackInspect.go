@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"text/template"
+
+	"github.com/greenled/portainer-stack-utils/client"
+	"github.com/greenled/portainer-stack-utils/common"
+	portainer "github.com/portainer/portainer/api"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// edgeStackInspectCmd represents the edge-stack inspect command
+var edgeStackInspectCmd = &cobra.Command{
+	Use:   "inspect <name>",
+	Short: "Inspect an edge stack",
+	Long:  "Inspect an edge stack, printing its deployment status in each endpoint.",
+	Example: `  Print the deployment status of an edge stack in each endpoint:
+  psu edge-stack inspect mystack
+
+  Print the endpoints where the edge stack deployment failed:
+  psu edge-stack inspect mystack --format "{{ range .Status }}{{ if eq .Type 2 }}{{ .EndpointID }} {{ end }}{{ end }}"`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		edgeStackName := args[0]
+
+		portainerClient, err := common.GetClient()
+		common.CheckError(err)
+
+		logrus.WithFields(logrus.Fields{
+			"stack": edgeStackName,
+		}).Debug("Getting edge stack")
+		edgeStack, edgeStackRetrievalErr := common.GetEdgeStackByName(edgeStackName)
+		if edgeStackRetrievalErr == common.ErrEdgeStackNotFound {
+			// The edge stack does not exist
+			logrus.WithFields(logrus.Fields{
+				"stack": edgeStackName,
+			}).Fatal("Edge stack not found")
+		}
+		common.CheckError(edgeStackRetrievalErr)
+
+		switch viper.GetString("edge-stack.inspect.format") {
+		case "table":
+			logrus.Debug("Getting endpoints")
+			endpoints, err := portainerClient.EndpointList()
+			common.CheckError(err)
+
+			logrus.Debug("Getting edge groups")
+			edgeGroups, err := portainerClient.EdgeGroupList()
+			common.CheckError(err)
+
+			// Print edge stack status in each endpoint in a table format
+			writer, err := common.NewTabWriter([]string{
+				"ENDPOINT",
+				"STATUS",
+				"ERROR",
+			})
+			common.CheckError(err)
+			for _, status := range getEdgeStackStatuses(edgeStack, edgeGroups) {
+				endpointName := fmt.Sprint(status.EndpointID)
+				if endpoint, err := common.GetEndpointFromListByID(endpoints, status.EndpointID); err == nil {
+					endpointName = endpoint.Name
+				}
+				_, err = fmt.Fprintln(writer, fmt.Sprintf(
+					"%s\t%s\t%s",
+					endpointName,
+					client.GetTranslatedEdgeStackStatusType(status.Type),
+					status.Error,
+				))
+				common.CheckError(err)
+			}
+			flushErr := writer.Flush()
+			common.CheckError(flushErr)
+		case "json":
+			// Print edge stack in a json format
+			edgeStackJSONBytes, err := json.Marshal(edgeStack)
+			common.CheckError(err)
+			fmt.Println(string(edgeStackJSONBytes))
+		default:
+			// Print edge stack in a custom format
+			template, templateParsingErr := template.New("edgeStackTpl").Parse(viper.GetString("edge-stack.inspect.format"))
+			common.CheckError(templateParsingErr)
+			templateExecutionErr := template.Execute(os.Stdout, edgeStack)
+			common.CheckError(templateExecutionErr)
+			fmt.Println()
+		}
+	},
+}
+
+func init() {
+	edgeStackCmd.AddCommand(edgeStackInspectCmd)
+
+	edgeStackInspectCmd.Flags().String("format", "table", `Output format. Can be "table", "json" or a Go template.`)
+	viper.BindPFlag("edge-stack.inspect.format", edgeStackInspectCmd.Flags().Lookup("format"))
+
+	edgeStackInspectCmd.SetUsageTemplate(edgeStackInspectCmd.UsageTemplate() + common.GetFormatHelp(client.EdgeStack{}))
+}
+
+// getEdgeStackStatuses returns an edge stack deployment status in each
+// endpoint, sorted by endpoint id. Endpoints of the edge stack's edge groups
+// which did not report a status yet are included as pending.
+func getEdgeStackStatuses(edgeStack client.EdgeStack, edgeGroups []client.EdgeGroup) (statuses []client.EdgeStackStatus) {
+	endpointStatuses := map[portainer.EndpointID]client.EdgeStackStatus{}
+	for _, edgeGroup := range edgeGroups {
+		for _, edgeGroupID := range edgeStack.EdgeGroups {
+			if edgeGroup.ID != edgeGroupID {
+				continue
+			}
+			for _, endpointID := range edgeGroup.Endpoints {
+				endpointStatuses[endpointID] = client.EdgeStackStatus{}
+			}
+		}
+	}
+	for endpointID, status := range edgeStack.Status {
+		endpointStatuses[endpointID] = status
+	}
+
+	var endpointIDs []int
+	for endpointID := range endpointStatuses {
+		endpointIDs = append(endpointIDs, int(endpointID))
+	}
+	sort.Ints(endpointIDs)
+	for _, endpointID := range endpointIDs {
+		status := endpointStatuses[portainer.EndpointID(endpointID)]
+		// Older Portainer versions do not set the endpoint id in the status
+		status.EndpointID = portainer.EndpointID(endpointID)
+		statuses = append(statuses, status)
+	}
+	return
+}
@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/greenled/portainer-stack-utils/client"
+	"github.com/greenled/portainer-stack-utils/common"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// edgeStackListCmd represents the edge-stack list command
+var edgeStackListCmd = &cobra.Command{
+	Use:     "list",
+	Short:   "List edge stacks",
+	Aliases: []string{"ls"},
+	Example: `  Print edge stacks in a table format:
+  psu edge-stack ls
+
+  Print names of edge stacks:
+  psu edge-stack ls --format "{{ .Name }}"`,
+	Run: func(cmd *cobra.Command, args []string) {
+		portainerClient, err := common.GetClient()
+		common.CheckError(err)
+
+		logrus.Debug("Getting edge stacks")
+		edgeStacks, err := portainerClient.EdgeStackList()
+		common.CheckError(err)
+
+		switch viper.GetString("edge-stack.list.format") {
+		case "table":
+			logrus.Debug("Getting edge groups")
+			edgeGroups, err := portainerClient.EdgeGroupList()
+			common.CheckError(err)
+
+			// Print edge stacks in a table format
+			writer, err := common.NewTabWriter([]string{
+				"ID",
+				"NAME",
+				"EDGE GROUPS",
+				"STATUS",
+			})
+			common.CheckError(err)
+			for _, s := range edgeStacks {
+				_, err = fmt.Fprintln(writer, fmt.Sprintf(
+					"%v\t%s\t%s\t%s",
+					s.ID,
+					s.Name,
+					strings.Join(getEdgeGroupNames(edgeGroups, s.EdgeGroups), ","),
+					getEdgeStackStatusSummary(s),
+				))
+				common.CheckError(err)
+			}
+			flushErr := writer.Flush()
+			common.CheckError(flushErr)
+		case "json":
+			// Print edge stacks in a json format
+			edgeStacksJSONBytes, err := json.Marshal(edgeStacks)
+			common.CheckError(err)
+			fmt.Println(string(edgeStacksJSONBytes))
+		default:
+			// Print edge stacks in a custom format
+			template, templateParsingErr := template.New("edgeStackTpl").Parse(viper.GetString("edge-stack.list.format"))
+			common.CheckError(templateParsingErr)
+			for _, s := range edgeStacks {
+				templateExecutionErr := template.Execute(os.Stdout, s)
+				common.CheckError(templateExecutionErr)
+				fmt.Println()
+			}
+		}
+	},
+}
+
+func init() {
+	edgeStackCmd.AddCommand(edgeStackListCmd)
+
+	edgeStackListCmd.Flags().String("format", "table", `Output format. Can be "table", "json" or a Go template.`)
+	viper.BindPFlag("edge-stack.list.format", edgeStackListCmd.Flags().Lookup("format"))
+
+	edgeStackListCmd.SetUsageTemplate(edgeStackListCmd.UsageTemplate() + common.GetFormatHelp(client.EdgeStack{}))
+}
+
+// getEdgeGroupNames returns the names of the edge groups with the given ids.
+// Unknown edge groups are represented by their id.
+func getEdgeGroupNames(edgeGroups []client.EdgeGroup, ids []client.EdgeGroupID) (names []string) {
+	for _, id := range ids {
+		name := fmt.Sprint(id)
+		for _, edgeGroup := range edgeGroups {
+			if edgeGroup.ID == id {
+				name = edgeGroup.Name
+				break
+			}
+		}
+		names = append(names, name)
+	}
+	return
+}
+
+// getEdgeStackStatusSummary returns the number of endpoints in each
+// deployment status of an edge stack, like "2 ok, 1 error"
+func getEdgeStackStatusSummary(edgeStack client.EdgeStack) string {
+	counts := map[client.EdgeStackStatusType]int{}
+	for _, status := range edgeStack.Status {
+		counts[status.Type]++
+	}
+	var summary []string
+	for _, statusType := range []client.EdgeStackStatusType{
+		client.EdgeStackStatusOk,
+		client.EdgeStackStatusError,
+		client.EdgeStackStatusAcknowledged,
+	} {
+		if counts[statusType] > 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", counts[statusType], client.GetTranslatedEdgeStackStatusType(statusType)))
+		}
+	}
+	if len(summary) == 0 {
+		return "-"
+	}
+	return strings.Join(summary, ", ")
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"github.com/greenled/portainer-stack-utils/common"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// edgeStackRemoveCmd represents the edge-stack remove command
+var edgeStackRemoveCmd = &cobra.Command{
+	Use:     "remove <name>...",
+	Short:   "Remove one or more edge stacks",
+	Long:    "Remove one or more edge stacks from the endpoints of their edge groups.",
+	Aliases: []string{"rm", "down"},
+	Example: `  Remove an edge stack:
+  psu edge-stack rm mystack
+
+  Remove several edge stacks, failing if any of them does not exist:
+  psu edge-stack rm mystack myotherstack --strict`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		portainerClient, err := common.GetClient()
+		common.CheckError(err)
+
+		for _, edgeStackName := range args {
+			logrus.WithFields(logrus.Fields{
+				"stack": edgeStackName,
+			}).Debug("Getting edge stack")
+			edgeStack, edgeStackRetrievalErr := common.GetEdgeStackByName(edgeStackName)
+			if edgeStackRetrievalErr == common.ErrEdgeStackNotFound {
+				// The edge stack does not exist
+				logrus.WithFields(logrus.Fields{
+					"stack": edgeStackName,
+				}).Debug("Edge stack not found")
+				if viper.GetBool("edge-stack.remove.strict") {
+					logrus.WithFields(logrus.Fields{
+						"stack":       edgeStackName,
+						"suggestions": "list the available edge stacks: psu edge-stack ls",
+					}).Fatal("edge stack does not exist")
+				}
+				continue
+			}
+			common.CheckError(edgeStackRetrievalErr)
+
+			logrus.WithFields(logrus.Fields{
+				"stack": edgeStack.Name,
+			}).Info("Removing edge stack")
+			err := portainerClient.EdgeStackDelete(edgeStack.ID)
+			common.CheckError(err)
+			logrus.WithFields(logrus.Fields{
+				"stack": edgeStack.Name,
+			}).Info("Edge stack removed")
+		}
+	},
+}
+
+func init() {
+	edgeStackCmd.AddCommand(edgeStackRemoveCmd)
+
+	edgeStackRemoveCmd.Flags().Bool("strict", false, "Fail if an edge stack does not exist.")
+	viper.BindPFlag("edge-stack.remove.strict", edgeStackRemoveCmd.Flags().Lookup("strict"))
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"github.com/greenled/portainer-stack-utils/client"
+	"github.com/greenled/portainer-stack-utils/common"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// endpointAccessCmd represents the endpoint access command
+var endpointAccessCmd = &cobra.Command{
+	Use:   "access <endpointName>",
+	Short: "Manage users and teams authorized to access an endpoint",
+	Example: `  Authorize a team to access an endpoint:
+  psu endpoint access primary --add-team developers
+
+  Print the users and teams authorized to access an endpoint:
+  psu endpoint access primary --list`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		changes, changed, err := common.GetAccessControlChanges("endpoint.access")
+		common.CheckError(err)
+		if !changed && !viper.GetBool("endpoint.access.list") {
+			logrus.WithFields(logrus.Fields{
+				"suggestions": "Use one of --add-user, --remove-user, --add-team, --remove-team or --list flags",
+			}).Fatal("Nothing to do")
+		}
+
+		endpoint, err := common.GetEndpointByName(args[0])
+		common.CheckError(err)
+
+		if changed {
+			userPolicies, teamPolicies := changes.ApplyToAccessPolicies(endpoint.UserAccessPolicies, endpoint.TeamAccessPolicies)
+
+			portainerClient, err := common.GetClient()
+			common.CheckError(err)
+
+			logrus.WithFields(logrus.Fields{
+				"endpoint": endpoint.Name,
+			}).Debug("Updating endpoint access")
+			endpoint, err = portainerClient.EndpointUpdate(client.EndpointUpdateOptions{
+				ID:                 endpoint.ID,
+				UserAccessPolicies: userPolicies,
+				TeamAccessPolicies: teamPolicies,
+			})
+			common.CheckError(err)
+
+			logrus.WithFields(logrus.Fields{
+				"endpoint": endpoint.Name,
+			}).Info("Endpoint access updated")
+		}
+
+		if viper.GetBool("endpoint.access.list") {
+			entries, err := common.GetEndpointAccessEntries(endpoint.UserAccessPolicies, endpoint.TeamAccessPolicies)
+			common.CheckError(err)
+			err = common.PrintEndpointAccessEntries(entries, viper.GetString("endpoint.access.format"))
+			common.CheckError(err)
+		}
+	},
+}
+
+func init() {
+	endpointCmd.AddCommand(endpointAccessCmd)
+
+	endpointAccessCmd.Flags().StringSlice("add-user", []string{}, "Authorize users to access this endpoint, by name. Can be used several times.")
+	endpointAccessCmd.Flags().StringSlice("remove-user", []string{}, "Revoke users access to this endpoint, by name. Can be used several times.")
+	endpointAccessCmd.Flags().StringSlice("add-team", []string{}, "Authorize teams to access this endpoint, by name. Can be used several times.")
+	endpointAccessCmd.Flags().StringSlice("remove-team", []string{}, "Revoke teams access to this endpoint, by name. Can be used several times.")
+	endpointAccessCmd.Flags().Bool("list", false, "Print the users and teams authorized to access this endpoint (after applying any change).")
+	endpointAccessCmd.Flags().String("format", "table", `Output format for --list. Can be "table", "json" or a Go template.`)
+	viper.BindPFlag("endpoint.access.add-user", endpointAccessCmd.Flags().Lookup("add-user"))
+	viper.BindPFlag("endpoint.access.remove-user", endpointAccessCmd.Flags().Lookup("remove-user"))
+	viper.BindPFlag("endpoint.access.add-team", endpointAccessCmd.Flags().Lookup("add-team"))
+	viper.BindPFlag("endpoint.access.remove-team", endpointAccessCmd.Flags().Lookup("remove-team"))
+	viper.BindPFlag("endpoint.access.list", endpointAccessCmd.Flags().Lookup("list"))
+	viper.BindPFlag("endpoint.access.format", endpointAccessCmd.Flags().Lookup("format"))
+
+	endpointAccessCmd.SetUsageTemplate(endpointAccessCmd.UsageTemplate() + common.GetFormatHelp(common.EndpointAccessEntry{}))
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"github.com/greenled/portainer-stack-utils/client"
+	"github.com/greenled/portainer-stack-utils/common"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// endpointGroupAccessCmd represents the endpoint group access command
+var endpointGroupAccessCmd = &cobra.Command{
+	Use:   "access <endpointGroupName>",
+	Short: "Manage users and teams authorized to access an endpoint group",
+	Example: `  Authorize a team to access an endpoint group:
+  psu endpoint group access production --add-team developers
+
+  Print the users and teams authorized to access an endpoint group:
+  psu endpoint group access production --list`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		changes, changed, err := common.GetAccessControlChanges("endpoint.group.access")
+		common.CheckError(err)
+		if !changed && !viper.GetBool("endpoint.group.access.list") {
+			logrus.WithFields(logrus.Fields{
+				"suggestions": "Use one of --add-user, --remove-user, --add-team, --remove-team or --list flags",
+			}).Fatal("Nothing to do")
+		}
+
+		endpointGroup, err := common.GetEndpointGroupByName(args[0])
+		common.CheckError(err)
+
+		if changed {
+			userPolicies, teamPolicies := changes.ApplyToAccessPolicies(endpointGroup.UserAccessPolicies, endpointGroup.TeamAccessPolicies)
+
+			portainerClient, err := common.GetClient()
+			common.CheckError(err)
+
+			logrus.WithFields(logrus.Fields{
+				"endpointGroup": endpointGroup.Name,
+			}).Debug("Updating endpoint group access")
+			endpointGroup, err = portainerClient.EndpointGroupUpdate(client.EndpointGroupUpdateOptions{
+				ID:                 endpointGroup.ID,
+				UserAccessPolicies: userPolicies,
+				TeamAccessPolicies: teamPolicies,
+			})
+			common.CheckError(err)
+
+			logrus.WithFields(logrus.Fields{
+				"endpointGroup": endpointGroup.Name,
+			}).Info("Endpoint group access updated")
+		}
+
+		if viper.GetBool("endpoint.group.access.list") {
+			entries, err := common.GetEndpointAccessEntries(endpointGroup.UserAccessPolicies, endpointGroup.TeamAccessPolicies)
+			common.CheckError(err)
+			err = common.PrintEndpointAccessEntries(entries, viper.GetString("endpoint.group.access.format"))
+			common.CheckError(err)
+		}
+	},
+}
+
+func init() {
+	endpointGroupCmd.AddCommand(endpointGroupAccessCmd)
+
+	endpointGroupAccessCmd.Flags().StringSlice("add-user", []string{}, "Authorize users to access this endpoint group, by name. Can be used several times.")
+	endpointGroupAccessCmd.Flags().StringSlice("remove-user", []string{}, "Revoke users access to this endpoint group, by name. Can be used several times.")
+	endpointGroupAccessCmd.Flags().StringSlice("add-team", []string{}, "Authorize teams to access this endpoint group, by name. Can be used several times.")
+	endpointGroupAccessCmd.Flags().StringSlice("remove-team", []string{}, "Revoke teams access to this endpoint group, by name. Can be used several times.")
+	endpointGroupAccessCmd.Flags().Bool("list", false, "Print the users and teams authorized to access this endpoint group (after applying any change).")
+	endpointGroupAccessCmd.Flags().String("format", "table", `Output format for --list. Can be "table", "json" or a Go template.`)
+	viper.BindPFlag("endpoint.group.access.add-user", endpointGroupAccessCmd.Flags().Lookup("add-user"))
+	viper.BindPFlag("endpoint.group.access.remove-user", endpointGroupAccessCmd.Flags().Lookup("remove-user"))
+	viper.BindPFlag("endpoint.group.access.add-team", endpointGroupAccessCmd.Flags().Lookup("add-team"))
+	viper.BindPFlag("endpoint.group.access.remove-team", endpointGroupAccessCmd.Flags().Lookup("remove-team"))
+	viper.BindPFlag("endpoint.group.access.list", endpointGroupAccessCmd.Flags().Lookup("list"))
+	viper.BindPFlag("endpoint.group.access.format", endpointGroupAccessCmd.Flags().Lookup("format"))
+
+	endpointGroupAccessCmd.SetUsageTemplate(endpointGroupAccessCmd.UsageTemplate() + common.GetFormatHelp(common.EndpointAccessEntry{}))
+}
@@ -0,0 +1,509 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/greenled/portainer-stack-utils/client"
+	"github.com/greenled/portainer-stack-utils/common"
+	portainer "github.com/portainer/portainer/api"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// Stack plan actions
+const (
+	stackPlanActionCreate = "create"
+	stackPlanActionUpdate = "update"
+	stackPlanActionDelete = "delete"
+	stackPlanActionNone   = "none"
+)
+
+// manifestHelp is the help string describing the manifest file format
+const manifestHelp = `
+Manifest:
+  The manifest is a YAML file describing the desired state of stacks. Paths are
+  relative to the manifest file location. Environment variables in "env" take
+  precedence over the ones in "env-files".
+
+  stacks:
+    - name: mystack              # Stack name (required)
+      endpoint: primary          # Endpoint name (optional if there is only one endpoint)
+      file: mystack.yml          # Stack file (required)
+      env-files: [mystack.env]   # Files with environment variables
+      env:                       # Environment variables
+        KEY: value
+      access: private            # One of admins, private or public (unmanaged if unset)
+      prune: true                # Prune services that are no longer referenced
+`
+
+// manifest represents a file describing the desired state of several stacks
+type manifest struct {
+	Stacks []manifestStack `yaml:"stacks"`
+}
+
+// manifestStack represents the desired state of a stack in a manifest
+type manifestStack struct {
+	Name     string            `yaml:"name"`
+	Endpoint string            `yaml:"endpoint"`
+	File     string            `yaml:"file"`
+	EnvFiles []string          `yaml:"env-files"`
+	Env      map[string]string `yaml:"env"`
+	Access   string            `yaml:"access"`
+	Prune    bool              `yaml:"prune"`
+}
+
+// StackPlanAction represents an action needed to bring a stack to the state
+// described in a manifest
+type StackPlanAction struct {
+	Action   string
+	Stack    string
+	Endpoint string
+	Changes  []string
+}
+
+// stackPlanStep represents a plan action along with the data needed to execute it
+type stackPlanStep struct {
+	StackPlanAction
+	manifestStack        manifestStack
+	stack                portainer.Stack
+	endpoint             portainer.Endpoint
+	swarmClusterID       string
+	stackFileContent     string
+	stackFileSources     []common.StackFileSource
+	environmentVariables []portainer.Pair
+}
+
+// hasChange checks if a plan step includes a given change
+func (s stackPlanStep) hasChange(change string) bool {
+	for _, c := range s.Changes {
+		if c == change {
+			return true
+		}
+	}
+	return false
+}
+
+// loadManifest loads a manifest file. Stack and env file paths are made
+// relative to the manifest file location.
+func loadManifest(path string) (m manifest, err error) {
+	manifestBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	err = yaml.UnmarshalStrict(manifestBytes, &m)
+	if err != nil {
+		return
+	}
+
+	manifestDir := filepath.Dir(path)
+	for i := range m.Stacks {
+		s := &m.Stacks[i]
+		if s.Name == "" {
+			err = fmt.Errorf("stack #%d in manifest has no name", i+1)
+			return
+		}
+		if s.File == "" {
+			err = fmt.Errorf("stack %s in manifest has no file", s.Name)
+			return
+		}
+		switch s.Access {
+		case "", "admins", "private", "public":
+		default:
+			err = fmt.Errorf("stack %s in manifest has an invalid access %q (must be one of admins, private or public)", s.Name, s.Access)
+			return
+		}
+		if !filepath.IsAbs(s.File) {
+			s.File = filepath.Join(manifestDir, s.File)
+		}
+		for j := range s.EnvFiles {
+			if !filepath.IsAbs(s.EnvFiles[j]) {
+				s.EnvFiles[j] = filepath.Join(manifestDir, s.EnvFiles[j])
+			}
+		}
+	}
+
+	return
+}
+
+// getManifestStackEnvironmentVariables loads a manifest stack's environment
+// variables from its env files and inline variables (which take precedence)
+func getManifestStackEnvironmentVariables(s manifestStack) (variables []portainer.Pair, err error) {
+	variablesMap := map[string]string{}
+	for _, envFile := range s.EnvFiles {
+		var loadedVariables []portainer.Pair
+		loadedVariables, err = loadEnvironmentVariablesFile(envFile)
+		if err != nil {
+			return
+		}
+		for _, variable := range loadedVariables {
+			variablesMap[variable.Name] = variable.Value
+		}
+	}
+	for name, value := range s.Env {
+		variablesMap[name] = value
+	}
+
+	for name, value := range variablesMap {
+		variables = append(variables, portainer.Pair{
+			Name:  name,
+			Value: value,
+		})
+	}
+	sort.Slice(variables, func(i, j int) bool {
+		return variables[i].Name < variables[j].Name
+	})
+
+	return
+}
+
+// computePlan compares the stacks described in a manifest with the existing
+// ones, and returns the actions needed to make them match. If pruneUnmanaged
+// is set, stacks in the manifest endpoints which are not in the manifest are
+// planned for deletion.
+func computePlan(m manifest, pruneUnmanaged bool) (steps []stackPlanStep, err error) {
+	portainerClient, err := common.GetClient()
+	if err != nil {
+		return
+	}
+
+	logrus.Debug("Getting endpoints")
+	endpoints, err := portainerClient.EndpointList()
+	if err != nil {
+		return
+	}
+
+	swarmClusterIDs := map[portainer.EndpointID]string{}
+	endpointStacks := map[portainer.EndpointID][]portainer.Stack{}
+	var endpointIDs []portainer.EndpointID
+	managedStacks := map[portainer.StackID]bool{}
+	plannedStacks := map[string]bool{}
+
+	for _, s := range m.Stacks {
+		step := stackPlanStep{
+			StackPlanAction: StackPlanAction{
+				Stack: s.Name,
+			},
+			manifestStack: s,
+		}
+
+		if s.Endpoint == "" {
+			if len(endpoints) != 1 {
+				err = fmt.Errorf("stack %s in manifest has no endpoint, and there is not exactly one endpoint available", s.Name)
+				return
+			}
+			step.endpoint = endpoints[0]
+		} else {
+			step.endpoint, err = common.GetEndpointFromListByName(endpoints, s.Endpoint)
+			if err != nil {
+				err = fmt.Errorf("%s: %s", s.Endpoint, err)
+				return
+			}
+		}
+		step.Endpoint = step.endpoint.Name
+
+		// Endpoints are compared once resolved, as an unset endpoint may be
+		// the same one another stack sets explicitly
+		stackKey := fmt.Sprintf("%s@%d", s.Name, step.endpoint.ID)
+		if plannedStacks[stackKey] {
+			err = fmt.Errorf("stack %s is declared more than once in manifest for endpoint %s", s.Name, step.endpoint.Name)
+			return
+		}
+		plannedStacks[stackKey] = true
+
+		if _, ok := endpointStacks[step.endpoint.ID]; !ok {
+			logrus.WithFields(logrus.Fields{
+				"endpoint": step.endpoint.Name,
+			}).Debug("Getting endpoint's Docker info")
+			swarmClusterID, selectionErr := common.GetEndpointSwarmClusterID(step.endpoint.ID)
+			if selectionErr != nil && selectionErr != common.ErrStackClusterNotFound {
+				err = selectionErr
+				return
+			}
+			swarmClusterIDs[step.endpoint.ID] = swarmClusterID
+
+			logrus.WithFields(logrus.Fields{
+				"endpoint": step.endpoint.Name,
+			}).Debug("Getting stacks")
+			endpointStacks[step.endpoint.ID], err = portainerClient.StackList(client.StackListOptions{
+				Filter: client.StackListFilter{
+					SwarmID:    swarmClusterID,
+					EndpointID: step.endpoint.ID,
+				},
+			})
+			if err != nil {
+				return
+			}
+			endpointIDs = append(endpointIDs, step.endpoint.ID)
+		}
+		step.swarmClusterID = swarmClusterIDs[step.endpoint.ID]
+
+		step.stackFileContent, step.stackFileSources, err = prepareStackFile(s.Name, s.File, step.swarmClusterID != "", false)
+		if err != nil {
+			return
+		}
+		step.environmentVariables, err = getManifestStackEnvironmentVariables(s)
+		if err != nil {
+			return
+		}
+
+		stackFound := false
+		for _, stack := range endpointStacks[step.endpoint.ID] {
+			if stack.Name == s.Name {
+				step.stack = stack
+				stackFound = true
+				break
+			}
+		}
+
+		if !stackFound {
+			step.Action = stackPlanActionCreate
+			steps = append(steps, step)
+			continue
+		}
+		managedStacks[step.stack.ID] = true
+
+		logrus.WithFields(logrus.Fields{
+			"stack":    step.stack.Name,
+			"endpoint": step.endpoint.Name,
+		}).Debug("Getting stack file content")
+		var currentStackFileContent string
+		currentStackFileContent, err = portainerClient.StackFileInspect(step.stack.ID)
+		if err != nil {
+			return
+		}
+		if currentStackFileContent != step.stackFileContent {
+			step.Changes = append(step.Changes, "file")
+		}
+		var environmentVariablesChanges common.EnvironmentVariablesChanges
+		_, environmentVariablesChanges, err = common.MergeEnvironmentVariables(step.stack.Env, step.environmentVariables, common.EnvStrategyReplace)
+		if err != nil {
+			return
+		}
+		if !environmentVariablesChanges.IsEmpty() {
+			step.Changes = append(step.Changes, "env")
+		}
+		if s.Access != "" {
+			var accessControl common.AccessControl
+			accessControl, err = common.GetAccessControl(s.Access, nil, nil)
+			if err != nil {
+				return
+			}
+			logrus.WithFields(logrus.Fields{
+				"stack":    step.stack.Name,
+				"endpoint": step.endpoint.Name,
+			}).Debug("Getting stack access control info")
+			resourceControl, accessControlErr := common.GetStackPortainerAccessControl(step.endpoint.ID, step.stack.Name)
+			if accessControlErr != nil && accessControlErr != common.ErrAccessControlNotFound {
+				err = accessControlErr
+				return
+			}
+			if !accessControl.Matches(resourceControl, accessControlErr == nil) {
+				step.Changes = append(step.Changes, "access")
+			}
+		}
+
+		if len(step.Changes) > 0 {
+			step.Action = stackPlanActionUpdate
+		} else {
+			step.Action = stackPlanActionNone
+		}
+		steps = append(steps, step)
+	}
+
+	if pruneUnmanaged {
+		for _, endpointID := range endpointIDs {
+			endpoint, _ := common.GetEndpointFromListByID(endpoints, endpointID)
+			for _, stack := range endpointStacks[endpointID] {
+				if managedStacks[stack.ID] {
+					continue
+				}
+				steps = append(steps, stackPlanStep{
+					StackPlanAction: StackPlanAction{
+						Action:   stackPlanActionDelete,
+						Stack:    stack.Name,
+						Endpoint: endpoint.Name,
+					},
+					stack:    stack,
+					endpoint: endpoint,
+				})
+			}
+		}
+	}
+
+	return
+}
+
+// executePlanStep executes a stack plan step
+func executePlanStep(step stackPlanStep) (err error) {
+	portainerClient, err := common.GetClient()
+	if err != nil {
+		return
+	}
+
+	logFields := logrus.Fields{
+		"stack":    step.Stack,
+		"endpoint": step.Endpoint,
+	}
+
+	switch step.Action {
+	case stackPlanActionCreate:
+		err = common.CreateStackFileSources(step.endpoint.ID, step.Stack, step.stackFileSources)
+		if err != nil {
+			return
+		}
+		logrus.WithFields(logFields).Info("Creating stack")
+		startedAt := time.Now()
+		if step.swarmClusterID != "" {
+			step.stack, err = portainerClient.StackCreateSwarm(client.StackCreateSwarmOptions{
+				StackName:            step.Stack,
+				EnvironmentVariables: step.environmentVariables,
+				StackFileContent:     step.stackFileContent,
+				SwarmClusterID:       step.swarmClusterID,
+				EndpointID:           step.endpoint.ID,
+			})
+		} else {
+			step.stack, err = portainerClient.StackCreateCompose(client.StackCreateComposeOptions{
+				StackName:            step.Stack,
+				EnvironmentVariables: step.environmentVariables,
+				StackFileContent:     step.stackFileContent,
+				EndpointID:           step.endpoint.ID,
+			})
+		}
+		common.Notify(common.NewNotification(common.NotificationActionDeploy, step.Stack, step.Endpoint, startedAt, err))
+		if err != nil {
+			return
+		}
+		if step.swarmClusterID != "" {
+			common.RemoveUnusedStackFileSources(step.endpoint.ID, step.Stack, step.stackFileSources)
+		}
+		if step.manifestStack.Access != "" {
+			err = setManifestStackAccess(step)
+			if err != nil {
+				return
+			}
+		}
+		logrus.WithFields(logFields).Info("Stack created")
+	case stackPlanActionUpdate:
+		if step.hasChange("file") || step.hasChange("env") {
+			err = common.CreateStackFileSources(step.endpoint.ID, step.Stack, step.stackFileSources)
+			if err != nil {
+				return
+			}
+			logrus.WithFields(logFields).Info("Updating stack")
+			startedAt := time.Now()
+			err = portainerClient.StackUpdate(client.StackUpdateOptions{
+				Stack:                step.stack,
+				EnvironmentVariables: step.environmentVariables,
+				StackFileContent:     step.stackFileContent,
+				Prune:                step.manifestStack.Prune,
+				EndpointID:           step.endpoint.ID,
+			})
+			common.Notify(common.NewNotification(common.NotificationActionDeploy, step.Stack, step.Endpoint, startedAt, err))
+			if err != nil {
+				return
+			}
+			if step.swarmClusterID != "" {
+				common.RemoveUnusedStackFileSources(step.endpoint.ID, step.Stack, step.stackFileSources)
+			}
+		}
+		if step.hasChange("access") {
+			err = setManifestStackAccess(step)
+			if err != nil {
+				return
+			}
+		}
+		logrus.WithFields(logFields).Info("Stack updated")
+	case stackPlanActionDelete:
+		logrus.WithFields(logFields).Info("Removing stack")
+		startedAt := time.Now()
+		err = portainerClient.StackDelete(step.stack.ID)
+		common.Notify(common.NewNotification(common.NotificationActionRemove, step.Stack, step.Endpoint, startedAt, err))
+		if err != nil {
+			return
+		}
+		logrus.WithFields(logFields).Info("Stack removed")
+	}
+
+	return
+}
+
+// setManifestStackAccess sets the access control of a stack as described in a manifest
+func setManifestStackAccess(step stackPlanStep) error {
+	accessControl, err := common.GetAccessControl(step.manifestStack.Access, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"stack":    step.Stack,
+		"endpoint": step.Endpoint,
+		"access":   step.manifestStack.Access,
+	}).Info("Setting stack access control")
+	return common.SetPortainerAccessControl(step.endpoint.ID, step.Stack, client.ResourceStack, accessControl)
+}
+
+// printPlan prints the actions of a stack plan in a table, json or custom format
+func printPlan(steps []stackPlanStep, format string) (err error) {
+	var actions []StackPlanAction
+	for _, step := range steps {
+		actions = append(actions, step.StackPlanAction)
+	}
+
+	switch format {
+	case "table":
+		// Print plan in a table format
+		writer, err := common.NewTabWriter([]string{
+			"ACTION",
+			"STACK",
+			"ENDPOINT",
+			"CHANGES",
+		})
+		if err != nil {
+			return err
+		}
+		for _, a := range actions {
+			_, err = fmt.Fprintln(writer, fmt.Sprintf(
+				"%s\t%s\t%s\t%s",
+				a.Action,
+				a.Stack,
+				a.Endpoint,
+				strings.Join(a.Changes, ","),
+			))
+			if err != nil {
+				return err
+			}
+		}
+		return writer.Flush()
+	case "json":
+		// Print plan in a json format
+		actionsJSONBytes, err := json.Marshal(actions)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(actionsJSONBytes))
+	default:
+		// Print plan in a custom format
+		template, err := template.New("planTpl").Parse(format)
+		if err != nil {
+			return err
+		}
+		for _, a := range actions {
+			err = template.Execute(os.Stdout, a)
+			if err != nil {
+				return err
+			}
+			fmt.Println()
+		}
+	}
+
+	return
+}
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"github.com/greenled/portainer-stack-utils/common"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// planCmd represents the plan command
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Show the changes needed to make stacks match a manifest",
+	Example: `  Print the actions needed to apply psu.yaml manifest:
+  psu plan
+
+  Print the actions needed to apply a manifest, including the removal of stacks not in the manifest:
+  psu plan --manifest stacks.yml --prune-unmanaged
+
+  Print the names of the stacks to be created or updated:
+  psu plan --format "{{ if ne .Action \"none\" }}{{ .Stack }}{{ end }}"`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		m, err := loadManifest(viper.GetString("plan.manifest"))
+		common.CheckError(err)
+
+		steps, err := computePlan(m, viper.GetBool("plan.prune-unmanaged"))
+		common.CheckError(err)
+
+		err = printPlan(steps, viper.GetString("plan.format"))
+		common.CheckError(err)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(planCmd)
+
+	planCmd.Flags().StringP("manifest", "m", "psu.yaml", "Path to a manifest file describing the stacks.")
+	planCmd.Flags().Bool("prune-unmanaged", false, "Plan the removal of stacks in the manifest endpoints which are not described in the manifest.")
+	planCmd.Flags().String("format", "table", `Output format. Can be "table", "json" or a Go template.`)
+	viper.BindPFlag("plan.manifest", planCmd.Flags().Lookup("manifest"))
+	viper.BindPFlag("plan.prune-unmanaged", planCmd.Flags().Lookup("prune-unmanaged"))
+	viper.BindPFlag("plan.format", planCmd.Flags().Lookup("format"))
+
+	planCmd.SetUsageTemplate(planCmd.UsageTemplate() + common.GetFormatHelp(StackPlanAction{}) + manifestHelp)
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/greenled/portainer-stack-utils/common"
 	"github.com/greenled/portainer-stack-utils/version"
 
 	"github.com/sirupsen/logrus"
@@ -47,6 +49,9 @@ func init() {
 	rootCmd.PersistentFlags().StringP("password", "p", "", "Portainer password.")
 	rootCmd.PersistentFlags().StringP("auth-token", "A", "", "Portainer auth token.")
 	rootCmd.PersistentFlags().DurationP("timeout", "t", 0, "Waiting time before aborting (like 100ms, 30s, 1h20m).")
+	rootCmd.PersistentFlags().StringSlice("notify-webhook", []string{}, "Webhook URL to notify after deploying or removing stacks. Can be used several times.")
+	rootCmd.PersistentFlags().String("notify-format", common.NotificationFormatJSON, fmt.Sprintf("Webhook notifications payload format. One of %s.", strings.Join(common.NotificationFormats, ", ")))
+	rootCmd.PersistentFlags().Duration("notify-timeout", 10*time.Second, "Waiting time for webhooks to respond to notifications (like 5s, 1m).")
 	viper.BindPFlag("settings-file", rootCmd.PersistentFlags().Lookup("settings-file"))
 	viper.BindPFlag("log-level", rootCmd.PersistentFlags().Lookup("log-level"))
 	viper.BindPFlag("log-format", rootCmd.PersistentFlags().Lookup("log-format"))
@@ -56,6 +61,9 @@ func init() {
 	viper.BindPFlag("user", rootCmd.PersistentFlags().Lookup("user"))
 	viper.BindPFlag("password", rootCmd.PersistentFlags().Lookup("password"))
 	viper.BindPFlag("auth-token", rootCmd.PersistentFlags().Lookup("auth-token"))
+	viper.BindPFlag("notify-webhook", rootCmd.PersistentFlags().Lookup("notify-webhook"))
+	viper.BindPFlag("notify-format", rootCmd.PersistentFlags().Lookup("notify-format"))
+	viper.BindPFlag("notify-timeout", rootCmd.PersistentFlags().Lookup("notify-timeout"))
 }
 
 // initSettings reads in setting file and ENV variables if set.
@@ -1,7 +1,7 @@
 package cmd
 
 import (
-	"net/http"
+	"fmt"
 
 	"github.com/greenled/portainer-stack-utils/client"
 	"github.com/greenled/portainer-stack-utils/common"
@@ -17,19 +17,8 @@ var stackAccessCmd = &cobra.Command{
 	Short: "Set access control for stack",
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		portainerClient, clientRetrievalErr := common.GetClient()
-		common.CheckError(clientRetrievalErr)
-
 		stackName := args[0]
 
-		setAdmins := viper.GetBool("stack.access.admins")
-		setPrivate := viper.GetBool("stack.access.private")
-		setPublic := viper.GetBool("stack.access.public")
-
-		if (setAdmins && setPrivate) || (setPrivate && setPublic) || (setPublic && setAdmins) {
-			logrus.Fatal("only one of --admins, --private or --public flags can be used")
-		}
-
 		var endpoint portainer.Endpoint
 		if endpointName := viper.GetString("stack.access.endpoint"); endpointName == "" {
 			// Guess endpoint if not set
@@ -54,66 +43,85 @@ var stackAccessCmd = &cobra.Command{
 			"endpoint": endpoint.Name,
 		}).Debug("Getting stack access control info")
 
-		if setAdmins {
-			// We are removing an access control
-			resourceControl, err := common.GetStackPortainerAccessControl(endpoint.ID, stackName)
-			if err == nil {
-				err = portainerClient.ResourceControlDelete(resourceControl.ID)
-			} else if err != common.ErrAccessControlNotFound {
-				common.CheckError(err)
-			}
-		} else {
-			// We may be creating a new access control
-			resourceControlCreateOptions := client.ResourceControlCreateOptions{
-				ResourceID: stackName,
-				Type:       client.ResourceStack,
-			}
-			if setPrivate {
-				currentUser, err := common.GetUserByName(portainerClient.GetUsername())
-				common.CheckError(err)
-				resourceControlCreateOptions.Users = []portainer.UserID{currentUser.ID}
-			}
-			if setPublic {
-				resourceControlCreateOptions.Public = true
-			}
-			_, err := portainerClient.ResourceControlCreate(resourceControlCreateOptions)
-
-			if err != nil {
-				genericError, isGenericError := err.(*client.GenericError)
-				if isGenericError && genericError.Code == http.StatusConflict {
-					// We are updating an existing access control
-					resourceControl, err := common.GetStackPortainerAccessControl(endpoint.ID, stackName)
-					if err == nil {
-						resourceControlUpdateOptions := client.ResourceControlUpdateOptions{
-							ID: resourceControl.ID,
-						}
-						if setPrivate {
-							currentUser, err := common.GetUserByName(portainerClient.GetUsername())
-							common.CheckError(err)
-							resourceControlUpdateOptions.Users = []portainer.UserID{currentUser.ID}
-						}
-						if setPublic {
-							resourceControlUpdateOptions.Public = true
-						}
-						_, err := portainerClient.ResourceControlUpdate(resourceControlUpdateOptions)
-						common.CheckError(err)
-					} else {
-						// Something else happened
-						common.CheckError(err)
-					}
-				} else {
-					// Something else happened
-					common.CheckError(err)
-				}
-			}
-		}
+		accessControl, accessControlErr := common.GetAccessCmdAccessControl("stack.access", endpoint.ID, stackName, client.ResourceStack)
+		common.CheckError(accessControlErr)
+
+		err := common.SetPortainerAccessControl(endpoint.ID, stackName, client.ResourceStack, accessControl)
+		common.CheckError(err)
 
 		logrus.WithFields(logrus.Fields{
 			"stack": stackName,
 		}).Info("Access control set")
+
+		if viper.GetBool("stack.access.recursive") {
+			err := setStackResourcesAccess(stackName, endpoint, accessControl)
+			common.CheckError(err)
+		}
 	},
 }
 
+// setStackResourcesAccess sets the access control of the Docker resources
+// belonging to a stack, reporting the changed ones
+func setStackResourcesAccess(stackName string, endpoint portainer.Endpoint, accessControl common.AccessControl) (err error) {
+	endpointSwarmClusterID, err := common.GetEndpointSwarmClusterID(endpoint.ID)
+	if err != nil && err != common.ErrStackClusterNotFound {
+		return
+	}
+
+	stack, err := common.GetStackByName(stackName, endpointSwarmClusterID, endpoint.ID)
+	if err != nil {
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"stack":    stack.Name,
+		"endpoint": endpoint.Name,
+	}).Debug("Getting stack resources")
+	resources, err := common.GetStackDockerResources(endpoint.ID, stack)
+	if err != nil {
+		return
+	}
+
+	changedResources, failedResources := 0, 0
+	for _, resource := range resources {
+		change, needed := common.GetAccessPolicyChange(resource, accessControl)
+		if !needed {
+			logrus.WithFields(logrus.Fields{
+				string(resource.Type): resource.Name,
+				"stack":               stack.Name,
+			}).Debug("Access control already set")
+			continue
+		}
+		change.Endpoint = endpoint.Name
+		changeErr := common.ApplyAccessPolicyChange(change)
+		if changeErr != nil {
+			logrus.WithFields(logrus.Fields{
+				string(resource.Type): resource.Name,
+				"stack":               stack.Name,
+				"message":             changeErr.Error(),
+			}).Error("Could not set access control")
+			failedResources++
+			continue
+		}
+		logrus.WithFields(logrus.Fields{
+			string(resource.Type): resource.Name,
+			"stack":               stack.Name,
+			"from":                change.From,
+			"to":                  change.To,
+		}).Info("Access control set")
+		changedResources++
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"stack": stack.Name,
+	}).Info(fmt.Sprintf("%d stack resource(s) changed, %d unchanged, %d failed", changedResources, len(resources)-changedResources-failedResources, failedResources))
+
+	if failedResources > 0 {
+		err = fmt.Errorf("access control could not be set for %d stack resource(s)", failedResources)
+	}
+	return
+}
+
 func init() {
 	stackCmd.AddCommand(stackAccessCmd)
 
@@ -121,8 +129,22 @@ func init() {
 	stackAccessCmd.Flags().Bool("admins", false, "Permit access to this stack to administrators only.")
 	stackAccessCmd.Flags().Bool("private", false, "Permit access to this stack to the current user only.")
 	stackAccessCmd.Flags().Bool("public", false, "Permit access to this stack to any user.")
+	stackAccessCmd.Flags().StringSlice("users", []string{}, "Permit access to this stack to users, by name. Can be used several times, and along with --private.")
+	stackAccessCmd.Flags().StringSlice("teams", []string{}, "Permit access to this stack to teams, by name. Can be used several times, and along with --private.")
+	stackAccessCmd.Flags().StringSlice("add-user", []string{}, "Add users to the ones with access to this stack, by name. Can be used several times.")
+	stackAccessCmd.Flags().StringSlice("remove-user", []string{}, "Remove users from the ones with access to this stack, by name. Can be used several times.")
+	stackAccessCmd.Flags().StringSlice("add-team", []string{}, "Add teams to the ones with access to this stack, by name. Can be used several times.")
+	stackAccessCmd.Flags().StringSlice("remove-team", []string{}, "Remove teams from the ones with access to this stack, by name. Can be used several times.")
+	stackAccessCmd.Flags().Bool("recursive", false, "Set the same access control on the services, containers, volumes, networks, secrets and configs of this stack.")
 	viper.BindPFlag("stack.access.endpoint", stackAccessCmd.Flags().Lookup("endpoint"))
 	viper.BindPFlag("stack.access.admins", stackAccessCmd.Flags().Lookup("admins"))
 	viper.BindPFlag("stack.access.private", stackAccessCmd.Flags().Lookup("private"))
 	viper.BindPFlag("stack.access.public", stackAccessCmd.Flags().Lookup("public"))
+	viper.BindPFlag("stack.access.users", stackAccessCmd.Flags().Lookup("users"))
+	viper.BindPFlag("stack.access.teams", stackAccessCmd.Flags().Lookup("teams"))
+	viper.BindPFlag("stack.access.add-user", stackAccessCmd.Flags().Lookup("add-user"))
+	viper.BindPFlag("stack.access.remove-user", stackAccessCmd.Flags().Lookup("remove-user"))
+	viper.BindPFlag("stack.access.add-team", stackAccessCmd.Flags().Lookup("add-team"))
+	viper.BindPFlag("stack.access.remove-team", stackAccessCmd.Flags().Lookup("remove-team"))
+	viper.BindPFlag("stack.access.recursive", stackAccessCmd.Flags().Lookup("recursive"))
 }
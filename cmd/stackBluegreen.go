@@ -0,0 +1,447 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/greenled/portainer-stack-utils/client"
+	"github.com/greenled/portainer-stack-utils/common"
+	portainer "github.com/portainer/portainer/api"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Blue/green deployment colors
+const (
+	bluegreenColorBlue  = "blue"
+	bluegreenColorGreen = "green"
+)
+
+// bluegreenSwitch represents the data passed to router label value templates
+type bluegreenSwitch struct {
+	// Name is the stack name, without color
+	Name string
+	// Color is the color being switched to
+	Color string
+	// Stack is the name of the stack being switched to
+	Stack string
+	// PreviousStack is the name of the stack being switched from (if any)
+	PreviousStack string
+}
+
+// stackBluegreenCmd represents the stack bluegreen command
+var stackBluegreenCmd = &cobra.Command{
+	Use:   "bluegreen <name>",
+	Short: "Deploy a new stack version next to the live one and switch to it",
+	Long: `Deploy a new stack version next to the live one and switch to it.
+
+The new version is deployed as "<name>-blue" or "<name>-green" (whichever is not live). Once it converges the routing is switched to it, and the old version is removed.
+
+The routing can be switched by setting labels on a router service (like a Traefik or Caddy service), running shell commands, or both. Router label values are Go templates, which are passed a cmd.bluegreenSwitch object:
+
+  {
+    Name string
+    Color string
+    Stack string
+    PreviousStack string
+  }
+
+Switch hooks get the same details in the PSU_BLUEGREEN_NAME, PSU_BLUEGREEN_COLOR, PSU_BLUEGREEN_STACK, PSU_BLUEGREEN_PREVIOUS_STACK and PSU_ENDPOINT environment variables.
+
+The stack file x-psu block endpoint, default environment variables and required psu version are used as in "psu stack deploy". Its access and prune values are ignored, as the new stack is always created from scratch. The block is stripped from the stack file uploaded to Portainer, unless the --keep-x-psu flag is set.`,
+	Example: `  Switch a Traefik router to the new version:
+  psu stack bluegreen myapp -c myapp.yml --router-service proxy_traefik --router-label 'traefik.http.routers.myapp.service={{ .Stack }}_web@docker'
+
+  Switch the routing with a script:
+  psu stack bluegreen myapp -c myapp.yml --switch-hook './switch-upstream.sh $PSU_BLUEGREEN_STACK'`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		stackName := args[0]
+
+		// Array flags are not bound to viper, as it does not support them
+		// (label values and hook commands may contain commas)
+		routerLabels, _ := cmd.Flags().GetStringArray("router-label")
+		if len(routerLabels) == 0 {
+			routerLabels = viper.GetStringSlice("stack.bluegreen.router-label")
+		}
+		switchHooks, _ := cmd.Flags().GetStringArray("switch-hook")
+		if len(switchHooks) == 0 {
+			switchHooks = viper.GetStringSlice("stack.bluegreen.switch-hook")
+		}
+		routerLabelTemplates := map[string]*template.Template{}
+		for _, routerLabel := range routerLabels {
+			labelParts := strings.SplitN(routerLabel, "=", 2)
+			if len(labelParts) != 2 || labelParts[0] == "" {
+				logrus.WithFields(logrus.Fields{
+					"label":       routerLabel,
+					"suggestions": "use KEY=VALUE format",
+				}).Fatal("invalid router label")
+			}
+			labelTemplate, parsingErr := template.New(labelParts[0]).Parse(labelParts[1])
+			common.CheckError(parsingErr)
+			routerLabelTemplates[labelParts[0]] = labelTemplate
+		}
+		if len(routerLabelTemplates) > 0 && viper.GetString("stack.bluegreen.router-service") == "" {
+			logrus.Fatal(`required flag(s) "router-service" not set`)
+		}
+		if viper.GetString("stack.bluegreen.router-service") == "" && len(switchHooks) == 0 {
+			logrus.WithFields(logrus.Fields{
+				"implications": "Both stack versions will be reachable until the old one is removed",
+				"suggestions":  "use --router-service and --router-label flags, or --switch-hook flag",
+			}).Warning("Routing switch not set")
+		}
+
+		var defaultEnvironmentVariables []portainer.Pair
+		if viper.GetString("stack.bluegreen.stack-file") != "" {
+			extension, found, loadingErr := loadStackFileExtension(viper.GetString("stack.bluegreen.stack-file"))
+			common.CheckError(loadingErr)
+			if found {
+				if extension.Endpoint != "" {
+					viper.SetDefault("stack.bluegreen.endpoint", extension.Endpoint)
+				}
+				defaultEnvironmentVariables = getStackFileExtensionEnvironmentVariables(extension)
+			}
+		}
+
+		var loadedEnvironmentVariables []portainer.Pair
+		if viper.GetString("stack.bluegreen.env-file") != "" {
+			var loadingErr error
+			loadedEnvironmentVariables, loadingErr = loadEnvironmentVariablesFile(viper.GetString("stack.bluegreen.env-file"))
+			common.CheckError(loadingErr)
+		}
+
+		portainerClient, clientRetrievalErr := common.GetClient()
+		common.CheckError(clientRetrievalErr)
+
+		var endpoint portainer.Endpoint
+		if endpointName := viper.GetString("stack.bluegreen.endpoint"); endpointName == "" {
+			// Guess endpoint if not set
+			logrus.WithFields(logrus.Fields{
+				"implications": "Command will fail if there is not exactly one endpoint available",
+			}).Warning("Endpoint not set")
+			var endpointRetrievalErr error
+			endpoint, endpointRetrievalErr = common.GetDefaultEndpoint()
+			common.CheckError(endpointRetrievalErr)
+			endpointName = endpoint.Name
+			logrus.WithFields(logrus.Fields{
+				"endpoint": endpointName,
+			}).Debug("Using the only available endpoint")
+		} else {
+			// Get endpoint by name
+			var endpointRetrievalErr error
+			endpoint, endpointRetrievalErr = common.GetEndpointByName(endpointName)
+			common.CheckError(endpointRetrievalErr)
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"endpoint": endpoint.Name,
+		}).Debug("Getting endpoint's Docker info")
+		endpointSwarmClusterID, selectionErr := common.GetEndpointSwarmClusterID(endpoint.ID)
+		if selectionErr == nil {
+			// It's a swarm cluster
+		} else if selectionErr == common.ErrStackClusterNotFound {
+			// It's not a swarm cluster
+			if viper.GetString("stack.bluegreen.router-service") != "" {
+				logrus.WithFields(logrus.Fields{
+					"endpoint":    endpoint.Name,
+					"suggestions": "use --switch-hook flag instead",
+				}).Fatal("router services are only available in Swarm endpoints")
+			}
+		} else {
+			// Something else happened
+			common.CheckError(selectionErr)
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"endpoint": endpoint.Name,
+		}).Debug("Getting stacks")
+		endpointStacks, stacksRetrievalErr := portainerClient.StackList(client.StackListOptions{
+			Filter: client.StackListFilter{
+				SwarmID:    endpointSwarmClusterID,
+				EndpointID: endpoint.ID,
+			},
+		})
+		common.CheckError(stacksRetrievalErr)
+
+		blueStackName := fmt.Sprintf("%s-%s", stackName, bluegreenColorBlue)
+		greenStackName := fmt.Sprintf("%s-%s", stackName, bluegreenColorGreen)
+		var liveStack portainer.Stack
+		isBlueLive := stackListContains(endpointStacks, blueStackName)
+		isGreenLive := stackListContains(endpointStacks, greenStackName)
+		if isBlueLive && isGreenLive {
+			suggestion := fmt.Sprintf("remove the one which is not live: either psu stack rm %s --endpoint %s or psu stack rm %s --endpoint %s", blueStackName, endpoint.Name, greenStackName, endpoint.Name)
+			routedColor, routingErr := getBluegreenRoutedColor(endpoint, stackName, routerLabelTemplates)
+			if routingErr != nil {
+				logrus.WithFields(logrus.Fields{
+					"service": viper.GetString("stack.bluegreen.router-service"),
+					"message": routingErr.Error(),
+				}).Debug("Could not tell the live stack from the router service labels")
+			}
+			switch routedColor {
+			case bluegreenColorBlue:
+				suggestion = fmt.Sprintf("remove the one which is not live: psu stack rm %s --endpoint %s", greenStackName, endpoint.Name)
+			case bluegreenColorGreen:
+				suggestion = fmt.Sprintf("remove the one which is not live: psu stack rm %s --endpoint %s", blueStackName, endpoint.Name)
+			}
+			logrus.WithFields(logrus.Fields{
+				"stacks":      fmt.Sprintf("%s, %s", blueStackName, greenStackName),
+				"endpoint":    endpoint.Name,
+				"suggestions": suggestion,
+			}).Fatal("both blue and green stacks exist")
+		}
+		newColor, newStackName := bluegreenColorBlue, blueStackName
+		if isBlueLive {
+			newColor, newStackName = bluegreenColorGreen, greenStackName
+		}
+		for _, stack := range endpointStacks {
+			if stack.Name == blueStackName || stack.Name == greenStackName {
+				liveStack = stack
+			}
+		}
+
+		var stackFileContent string
+		var stackFileSources []common.StackFileSource
+		if viper.GetString("stack.bluegreen.stack-file") != "" {
+			var loadingErr error
+			stackFileContent, stackFileSources, loadingErr = prepareStackFile(newStackName, viper.GetString("stack.bluegreen.stack-file"), endpointSwarmClusterID != "", viper.GetBool("stack.bluegreen.keep-x-psu"))
+			common.CheckError(loadingErr)
+		} else if liveStack.ID != 0 {
+			// Redeploy the live version
+			var stackFileContentRetrievalErr error
+			logrus.WithFields(logrus.Fields{
+				"stack": liveStack.Name,
+			}).Debug("Getting stack file content")
+			stackFileContent, stackFileContentRetrievalErr = portainerClient.StackFileInspect(liveStack.ID)
+			common.CheckError(stackFileContentRetrievalErr)
+		} else {
+			logrus.Fatal(`required flag(s) "stack-file" not set`)
+		}
+		if viper.GetString("stack.bluegreen.env-file") == "" {
+			// Keep the live version environment variables
+			loadedEnvironmentVariables = liveStack.Env
+		}
+		if len(defaultEnvironmentVariables) > 0 {
+			var mergingErr error
+			loadedEnvironmentVariables, _, mergingErr = common.MergeEnvironmentVariables(loadedEnvironmentVariables, defaultEnvironmentVariables, common.EnvStrategyKeepExisting)
+			common.CheckError(mergingErr)
+		}
+
+		common.CheckError(common.CreateStackFileSources(endpoint.ID, newStackName, stackFileSources))
+
+		logrus.WithFields(logrus.Fields{
+			"stack":    newStackName,
+			"endpoint": endpoint.Name,
+			"live":     liveStack.Name,
+		}).Info("Creating stack")
+		var newStack portainer.Stack
+		var deploymentErr error
+		startedAt := time.Now()
+		if endpointSwarmClusterID != "" {
+			// It's a swarm cluster
+			newStack, deploymentErr = portainerClient.StackCreateSwarm(client.StackCreateSwarmOptions{
+				StackName:            newStackName,
+				EnvironmentVariables: loadedEnvironmentVariables,
+				StackFileContent:     stackFileContent,
+				SwarmClusterID:       endpointSwarmClusterID,
+				EndpointID:           endpoint.ID,
+			})
+		} else {
+			// It's not a swarm cluster
+			newStack, deploymentErr = portainerClient.StackCreateCompose(client.StackCreateComposeOptions{
+				StackName:            newStackName,
+				EnvironmentVariables: loadedEnvironmentVariables,
+				StackFileContent:     stackFileContent,
+				EndpointID:           endpoint.ID,
+			})
+		}
+		if deploymentErr == nil {
+			deploymentErr = common.WaitForStackConvergence(endpoint.ID, newStack, viper.GetDuration("stack.bluegreen.wait-timeout"))
+		}
+		common.Notify(common.NewNotification(common.NotificationActionDeploy, newStackName, endpoint.Name, startedAt, deploymentErr))
+		if deploymentErr != nil {
+			logrus.WithFields(logrus.Fields{
+				"stack":   newStackName,
+				"message": deploymentErr.Error(),
+			}).Error("Stack creation failed, removing it")
+			rollbackStartedAt := time.Now()
+			rollbackErr := removeFailedStack(newStackName, endpointSwarmClusterID, endpoint)
+			common.Notify(common.NewNotification(common.NotificationActionRollback, newStackName, endpoint.Name, rollbackStartedAt, rollbackErr))
+			reportAtomicDeploymentFailure(newStackName, "The live stack was left untouched", deploymentErr, rollbackErr)
+		}
+		logrus.WithFields(logrus.Fields{
+			"stack":    newStackName,
+			"endpoint": endpoint.Name,
+			"id":       newStack.ID,
+		}).Info("Stack created")
+
+		bgSwitch := bluegreenSwitch{
+			Name:          stackName,
+			Color:         newColor,
+			Stack:         newStackName,
+			PreviousStack: liveStack.Name,
+		}
+		switchErr := switchBluegreenRouting(endpoint, bgSwitch, routerLabelTemplates, switchHooks)
+		if switchErr != nil {
+			logrus.WithFields(logrus.Fields{
+				"stack":        newStackName,
+				"live":         liveStack.Name,
+				"message":      switchErr.Error(),
+				"implications": "Both stack versions were kept, and the routing may be partially switched",
+				"suggestions":  "fix the routing manually and remove the stack which is not live",
+			}).Fatal("routing switch failed")
+		}
+
+		if liveStack.ID == 0 {
+			return
+		}
+		if viper.GetBool("stack.bluegreen.keep-old") {
+			logrus.WithFields(logrus.Fields{
+				"stack":    liveStack.Name,
+				"endpoint": endpoint.Name,
+			}).Info("Keeping old stack")
+			return
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"stack":    liveStack.Name,
+			"endpoint": endpoint.Name,
+		}).Info("Removing stack")
+		startedAt = time.Now()
+		removalErr := portainerClient.StackDelete(liveStack.ID)
+		common.Notify(common.NewNotification(common.NotificationActionRemove, liveStack.Name, endpoint.Name, startedAt, removalErr))
+		common.CheckError(removalErr)
+		logrus.WithFields(logrus.Fields{
+			"stack":    liveStack.Name,
+			"endpoint": endpoint.Name,
+		}).Info("Stack removed")
+
+		if endpointSwarmClusterID != "" && viper.GetString("stack.bluegreen.stack-file") != "" {
+			// The new stack does not use the old stack's configs and secrets created from local files
+			common.RemoveUnusedStackFileSources(endpoint.ID, liveStack.Name, nil)
+		}
+	},
+}
+
+func init() {
+	stackCmd.AddCommand(stackBluegreenCmd)
+
+	stackBluegreenCmd.Flags().StringP("stack-file", "c", "", "Path to a file with the content of the stack. Defaults to the live stack's one.")
+	stackBluegreenCmd.Flags().String("endpoint", "", "Endpoint name.")
+	stackBluegreenCmd.Flags().StringP("env-file", "e", "", "Path to a file with environment variables used during stack deployment. Defaults to the live stack's ones.")
+	stackBluegreenCmd.Flags().Duration("wait-timeout", 5*time.Minute, "Waiting time for the new stack services to be running before giving up (like 30s, 5m).")
+	stackBluegreenCmd.Flags().String("router-service", "", "Name of the Swarm service whose labels route the traffic (only available for Swarm stacks).")
+	stackBluegreenCmd.Flags().StringArray("router-label", []string{}, "Label to set on the router service to switch the traffic, in KEY=VALUE format. The value is a Go template. Can be used several times.")
+	stackBluegreenCmd.Flags().StringArray("switch-hook", []string{}, "Shell command to run to switch the traffic. Can be used several times.")
+	stackBluegreenCmd.Flags().Bool("keep-old", false, "Do not remove the old stack after switching to the new one.")
+	stackBluegreenCmd.Flags().Bool("keep-x-psu", false, fmt.Sprintf("Keep the %s block in the stack file uploaded to Portainer, instead of stripping it.", common.StackFileExtensionKey))
+	viper.BindPFlag("stack.bluegreen.stack-file", stackBluegreenCmd.Flags().Lookup("stack-file"))
+	viper.BindPFlag("stack.bluegreen.endpoint", stackBluegreenCmd.Flags().Lookup("endpoint"))
+	viper.BindPFlag("stack.bluegreen.env-file", stackBluegreenCmd.Flags().Lookup("env-file"))
+	viper.BindPFlag("stack.bluegreen.wait-timeout", stackBluegreenCmd.Flags().Lookup("wait-timeout"))
+	viper.BindPFlag("stack.bluegreen.router-service", stackBluegreenCmd.Flags().Lookup("router-service"))
+	viper.BindPFlag("stack.bluegreen.keep-old", stackBluegreenCmd.Flags().Lookup("keep-old"))
+	viper.BindPFlag("stack.bluegreen.keep-x-psu", stackBluegreenCmd.Flags().Lookup("keep-x-psu"))
+}
+
+// switchBluegreenRouting switches the traffic to a new stack color, by
+// setting the router service labels and running the switch hooks
+func switchBluegreenRouting(endpoint portainer.Endpoint, bgSwitch bluegreenSwitch, routerLabelTemplates map[string]*template.Template, switchHooks []string) (err error) {
+	if len(routerLabelTemplates) > 0 {
+		var labels map[string]string
+		labels, err = renderBluegreenRouterLabels(bgSwitch, routerLabelTemplates)
+		if err != nil {
+			return
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"service": viper.GetString("stack.bluegreen.router-service"),
+			"stack":   bgSwitch.Stack,
+		}).Info("Updating router service labels")
+		err = common.UpdateDockerServiceLabels(endpoint.ID, viper.GetString("stack.bluegreen.router-service"), labels)
+		if err != nil {
+			return
+		}
+	}
+
+	if len(switchHooks) > 0 {
+		logrus.WithFields(logrus.Fields{
+			"stack": bgSwitch.Stack,
+		}).Info("Running switch hooks")
+		err = common.RunHooks(switchHooks, map[string]string{
+			"PSU_BLUEGREEN_NAME":           bgSwitch.Name,
+			"PSU_BLUEGREEN_COLOR":          bgSwitch.Color,
+			"PSU_BLUEGREEN_STACK":          bgSwitch.Stack,
+			"PSU_BLUEGREEN_PREVIOUS_STACK": bgSwitch.PreviousStack,
+			"PSU_ENDPOINT":                 endpoint.Name,
+		})
+	}
+
+	return
+}
+
+// renderBluegreenRouterLabels renders the router label value templates for a switch
+func renderBluegreenRouterLabels(bgSwitch bluegreenSwitch, routerLabelTemplates map[string]*template.Template) (labels map[string]string, err error) {
+	labels = map[string]string{}
+	for key, labelTemplate := range routerLabelTemplates {
+		var value bytes.Buffer
+		err = labelTemplate.Execute(&value, bgSwitch)
+		if err != nil {
+			return
+		}
+		labels[key] = value.String()
+	}
+	return
+}
+
+// getBluegreenRoutedColor works out which stack color the router service
+// labels currently route the traffic to, by comparing them with the values
+// rendered for each color. It returns an empty color if there are no router
+// labels, or they match both or neither of the colors.
+func getBluegreenRoutedColor(endpoint portainer.Endpoint, stackName string, routerLabelTemplates map[string]*template.Template) (color string, err error) {
+	if len(routerLabelTemplates) == 0 {
+		return
+	}
+
+	routerService, err := common.ResolveDockerResource(endpoint.ID, client.ResourceService, viper.GetString("stack.bluegreen.router-service"))
+	if err != nil {
+		return
+	}
+
+	var routedColors []string
+	for _, c := range []string{bluegreenColorBlue, bluegreenColorGreen} {
+		otherColor := bluegreenColorGreen
+		if c == bluegreenColorGreen {
+			otherColor = bluegreenColorBlue
+		}
+		var labels map[string]string
+		labels, err = renderBluegreenRouterLabels(bluegreenSwitch{
+			Name:          stackName,
+			Color:         c,
+			Stack:         fmt.Sprintf("%s-%s", stackName, c),
+			PreviousStack: fmt.Sprintf("%s-%s", stackName, otherColor),
+		}, routerLabelTemplates)
+		if err != nil {
+			return
+		}
+
+		routed := true
+		for key, value := range labels {
+			if currentValue, exists := routerService.Labels[key]; !exists || currentValue != value {
+				routed = false
+				break
+			}
+		}
+		if routed {
+			routedColors = append(routedColors, c)
+		}
+	}
+
+	if len(routedColors) == 1 {
+		color = routedColors[0]
+	}
+	return
+}
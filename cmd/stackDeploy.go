@@ -1,7 +1,11 @@
 package cmd
 
 import (
+	"fmt"
 	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/greenled/portainer-stack-utils/client"
 
@@ -10,6 +14,7 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/greenled/portainer-stack-utils/common"
+	"github.com/greenled/portainer-stack-utils/version"
 	"github.com/joho/godotenv"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -20,9 +25,20 @@ var stackDeployCmd = &cobra.Command{
 	Use:     "deploy <name>",
 	Short:   "Deploy a new stack or update an existing one",
 	Aliases: []string{"up", "create"},
-	Example: "  psu stack deploy mystack --stack-file mystack.yml",
-	Args:    cobra.ExactArgs(1),
+	Example: `  Deploy a stack:
+  psu stack deploy mystack --stack-file mystack.yml
+
+  Deploy a stack accessible by the current user and a team:
+  psu stack deploy mystack --stack-file mystack.yml --access private --teams devs`,
+	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
+		var defaultEnvironmentVariables []portainer.Pair
+		if viper.GetString("stack.deploy.stack-file") != "" {
+			var loadingErr error
+			defaultEnvironmentVariables, loadingErr = applyStackFileExtension(viper.GetString("stack.deploy.stack-file"))
+			common.CheckError(loadingErr)
+		}
+
 		var loadedEnvironmentVariables []portainer.Pair
 		if viper.GetString("stack.deploy.env-file") != "" {
 			var loadingErr error
@@ -30,10 +46,20 @@ var stackDeployCmd = &cobra.Command{
 			common.CheckError(loadingErr)
 		}
 
+		envStrategy := viper.GetString("stack.deploy.env-strategy")
+		if viper.GetBool("stack.deploy.replace-env") {
+			envStrategy = common.EnvStrategyReplace
+		}
+
 		portainerClient, clientRetrievalErr := common.GetClient()
 		common.CheckError(clientRetrievalErr)
 
+		stackAccessControl, setStackAccess, accessControlErr := getStackDeployAccessControl()
+		common.CheckError(accessControlErr)
+
 		stackName := args[0]
+		preDeployHooks := getDeployHooks(cmd, deployHookStagePre, stackName)
+		postDeployHooks := getDeployHooks(cmd, deployHookStagePost, stackName)
 
 		var endpoint portainer.Endpoint
 		if endpointName := viper.GetString("stack.deploy.endpoint"); endpointName == "" {
@@ -68,6 +94,46 @@ var stackDeployCmd = &cobra.Command{
 			common.CheckError(selectionErr)
 		}
 
+		if viper.GetBool("stack.deploy.lock") {
+			lockOwner := viper.GetString("stack.deploy.lock-owner")
+			if lockOwner == "" {
+				lockOwner = common.GetDefaultStackLockOwner()
+			}
+
+			logrus.WithFields(logrus.Fields{
+				"stack":    stackName,
+				"endpoint": endpoint.Name,
+				"owner":    lockOwner,
+			}).Debug("Acquiring stack lock")
+			lock, lockErr := common.AcquireStackLock(endpoint.ID, endpointSwarmClusterID != "", stackName, lockOwner, viper.GetDuration("stack.deploy.lock-ttl"), viper.GetDuration("stack.deploy.lock-timeout"))
+			if lockErr == common.ErrStackLocked {
+				logrus.WithFields(logrus.Fields{
+					"stack":       stackName,
+					"endpoint":    endpoint.Name,
+					"owner":       lock.Owner,
+					"acquired-at": lock.AcquiredAt,
+					"suggestions": fmt.Sprintf("try again later, or remove the lock if it was abandoned: psu stack unlock %s --endpoint %s --force", stackName, endpoint.Name),
+				}).Fatal("stack is locked")
+			}
+			common.CheckError(lockErr)
+
+			releaseLock := func() {
+				logrus.WithFields(logrus.Fields{
+					"stack":    stackName,
+					"endpoint": endpoint.Name,
+				}).Debug("Releasing stack lock")
+				if releaseErr := lock.Release(); releaseErr != nil {
+					logrus.WithFields(logrus.Fields{
+						"stack":   stackName,
+						"message": releaseErr.Error(),
+					}).Warning("Stack lock could not be released")
+				}
+			}
+			// Fatal errors exit without running deferred functions
+			logrus.RegisterExitHandler(releaseLock)
+			defer releaseLock()
+		}
+
 		logrus.WithFields(logrus.Fields{
 			"stack":    stackName,
 			"endpoint": endpoint.Name,
@@ -80,9 +146,10 @@ var stackDeployCmd = &cobra.Command{
 			}).Debug("Stack found")
 
 			var stackFileContent string
+			var stackFileSources []common.StackFileSource
 			if viper.GetString("stack.deploy.stack-file") != "" {
 				var loadingErr error
-				stackFileContent, loadingErr = loadStackFile(viper.GetString("stack.deploy.stack-file"))
+				stackFileContent, stackFileSources, loadingErr = prepareStackFile(retrievedStack.Name, viper.GetString("stack.deploy.stack-file"), endpointSwarmClusterID != "", viper.GetBool("stack.deploy.keep-x-psu"))
 				common.CheckError(loadingErr)
 			} else {
 				var stackFileContentRetrievalErr error
@@ -93,30 +160,36 @@ var stackDeployCmd = &cobra.Command{
 				common.CheckError(stackFileContentRetrievalErr)
 			}
 
-			var newEnvironmentVariables []portainer.Pair
-			if viper.GetBool("stack.deploy.replace-env") {
-				newEnvironmentVariables = loadedEnvironmentVariables
-			} else {
-				// Merge stack environment variables with the loaded ones
-				newEnvironmentVariables = retrievedStack.Env
-			LoadedVariablesLoop:
-				for _, loadedEnvironmentVariable := range loadedEnvironmentVariables {
-					for _, newEnvironmentVariable := range newEnvironmentVariables {
-						if loadedEnvironmentVariable.Name == newEnvironmentVariable.Name {
-							newEnvironmentVariable.Value = loadedEnvironmentVariable.Value
-							continue LoadedVariablesLoop
-						}
-					}
-					newEnvironmentVariables = append(newEnvironmentVariables, portainer.Pair{
-						Name:  loadedEnvironmentVariable.Name,
-						Value: loadedEnvironmentVariable.Value,
-					})
-				}
+			newEnvironmentVariables, environmentVariablesChanges, mergingErr := common.MergeEnvironmentVariables(retrievedStack.Env, loadedEnvironmentVariables, envStrategy)
+			common.CheckError(mergingErr)
+			newEnvironmentVariables, environmentVariablesChanges = addDefaultEnvironmentVariables(newEnvironmentVariables, defaultEnvironmentVariables, environmentVariablesChanges)
+			logEnvironmentVariablesChanges(retrievedStack.Name, environmentVariablesChanges)
+
+			var previousStackFileContent string
+			if viper.GetBool("stack.deploy.atomic") && viper.GetString("stack.deploy.stack-file") == "" {
+				// The current stack file content is being redeployed, so it is the one to roll back to
+				previousStackFileContent = stackFileContent
+			} else if viper.GetBool("stack.deploy.atomic") {
+				// Keep the current stack version to roll back to it if the update fails
+				var stackFileContentRetrievalErr error
+				logrus.WithFields(logrus.Fields{
+					"stack": retrievedStack.Name,
+				}).Debug("Getting current stack file content")
+				previousStackFileContent, stackFileContentRetrievalErr = portainerClient.StackFileInspect(retrievedStack.ID)
+				common.CheckError(stackFileContentRetrievalErr)
+			}
+
+			runDeployHooks(preDeployHooks, deployHookStagePre, stackDeployActionUpdate, retrievedStack.Name, retrievedStack.ID, endpoint, nil)
+			if sourcesCreationErr := common.CreateStackFileSources(endpoint.ID, retrievedStack.Name, stackFileSources); sourcesCreationErr != nil {
+				// Pre-deploy hooks already ran, so the deployment is considered failed
+				runDeployHooks(postDeployHooks, deployHookStagePost, stackDeployActionUpdate, retrievedStack.Name, retrievedStack.ID, endpoint, sourcesCreationErr)
+				common.CheckError(sourcesCreationErr)
 			}
 
 			logrus.WithFields(logrus.Fields{
 				"stack": retrievedStack.Name,
 			}).Info("Updating stack")
+			startedAt := time.Now()
 			err := portainerClient.StackUpdate(client.StackUpdateOptions{
 				Stack:                retrievedStack,
 				EnvironmentVariables: newEnvironmentVariables,
@@ -124,7 +197,45 @@ var stackDeployCmd = &cobra.Command{
 				Prune:                viper.GetBool("stack.deploy.prune"),
 				EndpointID:           endpoint.ID,
 			})
+			if err == nil && isStackDeployWaitEnabled() {
+				err = common.WaitForStackConvergence(endpoint.ID, retrievedStack, viper.GetDuration("stack.deploy.wait-timeout"))
+			}
+
+			common.Notify(common.NewNotification(common.NotificationActionDeploy, retrievedStack.Name, endpoint.Name, startedAt, err))
+
+			var rollbackErr error
+			if err != nil && viper.GetBool("stack.deploy.atomic") {
+				logrus.WithFields(logrus.Fields{
+					"stack":   retrievedStack.Name,
+					"message": err.Error(),
+				}).Error("Stack update failed, rolling back")
+				rollbackStartedAt := time.Now()
+				rollbackErr = portainerClient.StackUpdate(client.StackUpdateOptions{
+					Stack:                retrievedStack,
+					EnvironmentVariables: retrievedStack.Env,
+					StackFileContent:     previousStackFileContent,
+					Prune:                viper.GetBool("stack.deploy.prune"),
+					EndpointID:           endpoint.ID,
+				})
+				if rollbackErr == nil {
+					rollbackErr = common.WaitForStackConvergence(endpoint.ID, retrievedStack, viper.GetDuration("stack.deploy.wait-timeout"))
+				}
+				common.Notify(common.NewNotification(common.NotificationActionRollback, retrievedStack.Name, endpoint.Name, rollbackStartedAt, rollbackErr))
+			}
+
+			if err == nil && endpointSwarmClusterID != "" && viper.GetString("stack.deploy.stack-file") != "" {
+				common.RemoveUnusedStackFileSources(endpoint.ID, retrievedStack.Name, stackFileSources)
+			}
+
+			runDeployHooks(postDeployHooks, deployHookStagePost, stackDeployActionUpdate, retrievedStack.Name, retrievedStack.ID, endpoint, err)
+			if err != nil && viper.GetBool("stack.deploy.atomic") {
+				reportAtomicDeploymentFailure(retrievedStack.Name, "The stack was rolled back to its previous version", err, rollbackErr)
+			}
 			common.CheckError(err)
+
+			if setStackAccess {
+				common.CheckError(setStackDeployAccess(retrievedStack.Name, endpoint, stackAccessControl, true))
+			}
 		} else if stackRetrievalErr == common.ErrStackNotFound {
 			// We are deploying a new stack
 			logrus.WithFields(logrus.Fields{
@@ -134,46 +245,76 @@ var stackDeployCmd = &cobra.Command{
 			if viper.GetString("stack.deploy.stack-file") == "" {
 				logrus.Fatal(`required flag(s) "stack-file" not set`)
 			}
-			stackFileContent, loadingErr := loadStackFile(viper.GetString("stack.deploy.stack-file"))
+			stackFileContent, stackFileSources, loadingErr := prepareStackFile(stackName, viper.GetString("stack.deploy.stack-file"), endpointSwarmClusterID != "", viper.GetBool("stack.deploy.keep-x-psu"))
 			common.CheckError(loadingErr)
 
+			newEnvironmentVariables, environmentVariablesChanges, mergingErr := common.MergeEnvironmentVariables(nil, loadedEnvironmentVariables, envStrategy)
+			common.CheckError(mergingErr)
+			newEnvironmentVariables, environmentVariablesChanges = addDefaultEnvironmentVariables(newEnvironmentVariables, defaultEnvironmentVariables, environmentVariablesChanges)
+			logEnvironmentVariablesChanges(stackName, environmentVariablesChanges)
+
+			runDeployHooks(preDeployHooks, deployHookStagePre, stackDeployActionCreate, stackName, 0, endpoint, nil)
+			if sourcesCreationErr := common.CreateStackFileSources(endpoint.ID, stackName, stackFileSources); sourcesCreationErr != nil {
+				// Pre-deploy hooks already ran, so the deployment is considered failed
+				runDeployHooks(postDeployHooks, deployHookStagePost, stackDeployActionCreate, stackName, 0, endpoint, sourcesCreationErr)
+				common.CheckError(sourcesCreationErr)
+			}
+
+			logrus.WithFields(logrus.Fields{
+				"stack":    stackName,
+				"endpoint": endpoint.Name,
+			}).Info("Creating stack")
+			var stack portainer.Stack
+			var deploymentErr error
+			startedAt := time.Now()
 			if endpointSwarmClusterID != "" {
 				// It's a swarm cluster
-				logrus.WithFields(logrus.Fields{
-					"stack":    stackName,
-					"endpoint": endpoint.Name,
-				}).Info("Creating stack")
-				stack, deploymentErr := portainerClient.StackCreateSwarm(client.StackCreateSwarmOptions{
+				stack, deploymentErr = portainerClient.StackCreateSwarm(client.StackCreateSwarmOptions{
 					StackName:            stackName,
-					EnvironmentVariables: loadedEnvironmentVariables,
+					EnvironmentVariables: newEnvironmentVariables,
 					StackFileContent:     stackFileContent,
 					SwarmClusterID:       endpointSwarmClusterID,
 					EndpointID:           endpoint.ID,
 				})
-				common.CheckError(deploymentErr)
-				logrus.WithFields(logrus.Fields{
-					"stack":    stack.Name,
-					"endpoint": endpoint.Name,
-					"id":       stack.ID,
-				}).Info("Stack created")
 			} else {
 				// It's not a swarm cluster
-				logrus.WithFields(logrus.Fields{
-					"stack":    stackName,
-					"endpoint": endpoint.Name,
-				}).Info("Creating stack")
-				stack, deploymentErr := portainerClient.StackCreateCompose(client.StackCreateComposeOptions{
+				stack, deploymentErr = portainerClient.StackCreateCompose(client.StackCreateComposeOptions{
 					StackName:            stackName,
-					EnvironmentVariables: loadedEnvironmentVariables,
+					EnvironmentVariables: newEnvironmentVariables,
 					StackFileContent:     stackFileContent,
 					EndpointID:           endpoint.ID,
 				})
-				common.CheckError(deploymentErr)
+			}
+			if deploymentErr == nil && isStackDeployWaitEnabled() {
+				deploymentErr = common.WaitForStackConvergence(endpoint.ID, stack, viper.GetDuration("stack.deploy.wait-timeout"))
+			}
+
+			common.Notify(common.NewNotification(common.NotificationActionDeploy, stackName, endpoint.Name, startedAt, deploymentErr))
+
+			var rollbackErr error
+			if deploymentErr != nil && viper.GetBool("stack.deploy.atomic") {
 				logrus.WithFields(logrus.Fields{
-					"stack":    stack.Name,
-					"endpoint": endpoint.Name,
-					"id":       stack.ID,
-				}).Info("Stack created")
+					"stack":   stackName,
+					"message": deploymentErr.Error(),
+				}).Error("Stack creation failed, removing it")
+				rollbackStartedAt := time.Now()
+				rollbackErr = removeFailedStack(stackName, endpointSwarmClusterID, endpoint)
+				common.Notify(common.NewNotification(common.NotificationActionRollback, stackName, endpoint.Name, rollbackStartedAt, rollbackErr))
+			}
+
+			runDeployHooks(postDeployHooks, deployHookStagePost, stackDeployActionCreate, stackName, stack.ID, endpoint, deploymentErr)
+			if deploymentErr != nil && viper.GetBool("stack.deploy.atomic") {
+				reportAtomicDeploymentFailure(stackName, "The half-created stack was removed", deploymentErr, rollbackErr)
+			}
+			common.CheckError(deploymentErr)
+			logrus.WithFields(logrus.Fields{
+				"stack":    stack.Name,
+				"endpoint": endpoint.Name,
+				"id":       stack.ID,
+			}).Info("Stack created")
+
+			if setStackAccess {
+				common.CheckError(setStackDeployAccess(stack.Name, endpoint, stackAccessControl, false))
 			}
 		} else {
 			// Something else happened
@@ -189,20 +330,324 @@ func init() {
 	stackDeployCmd.Flags().String("endpoint", "", "Endpoint name.")
 	stackDeployCmd.Flags().StringP("env-file", "e", "", "Path to a file with environment variables used during stack deployment.")
 	stackDeployCmd.Flags().Bool("replace-env", false, "Replace environment variables instead of merging them.")
+	stackDeployCmd.Flags().MarkDeprecated("replace-env", "use --env-strategy=replace instead")
+	stackDeployCmd.Flags().String("env-strategy", common.EnvStrategyMerge, fmt.Sprintf("Strategy used to merge loaded environment variables into the existing ones while updating a stack. One of %s.", strings.Join(common.EnvStrategies, ", ")))
 	stackDeployCmd.Flags().BoolP("prune", "r", false, "Prune services that are no longer referenced (only available for Swarm stacks).")
+	stackDeployCmd.Flags().StringArray("pre-deploy-hook", []string{}, "Shell command to run before deploying the stack. Can be used several times.")
+	stackDeployCmd.Flags().StringArray("post-deploy-hook", []string{}, "Shell command to run after deploying the stack, even if the deployment failed. Can be used several times.")
+	stackDeployCmd.Flags().Bool("wait", false, "Wait for the stack services to be running (and healthy) after deploying it, failing otherwise.")
+	stackDeployCmd.Flags().Duration("wait-timeout", 5*time.Minute, "Waiting time for the stack services to be running before giving up (like 30s, 5m).")
+	stackDeployCmd.Flags().Bool("atomic", false, "Roll back the stack to its previous version (or remove it, if it is new) if the deployment fails or the stack does not converge. Implies --wait.")
+	stackDeployCmd.Flags().Bool("lock", false, "Acquire a lock on the stack while deploying it, to prevent concurrent deployments.")
+	stackDeployCmd.Flags().Duration("lock-timeout", 5*time.Minute, "Waiting time for the stack lock to be released by someone else before giving up (like 30s, 5m).")
+	stackDeployCmd.Flags().Duration("lock-ttl", 15*time.Minute, "Time after which an abandoned stack lock is considered expired (like 10m, 1h).")
+	stackDeployCmd.Flags().String("lock-owner", "", "Stack lock owner. Defaults to \"USER@HOSTNAME\".")
+	stackDeployCmd.Flags().String("access", "", fmt.Sprintf("Access control to set on the stack after deploying it. One of %s. Existing stacks keep their access control unless set.", strings.Join(common.AccessModes, ", ")))
+	stackDeployCmd.Flags().StringSlice("users", []string{}, "Names of users to give access to the stack after deploying it. Can be used several times.")
+	stackDeployCmd.Flags().StringSlice("teams", []string{}, "Names of teams to give access to the stack after deploying it. Can be used several times.")
+	stackDeployCmd.Flags().Bool("keep-x-psu", false, fmt.Sprintf("Keep the %s block in the stack file uploaded to Portainer, instead of stripping it.", common.StackFileExtensionKey))
 	viper.BindPFlag("stack.deploy.stack-file", stackDeployCmd.Flags().Lookup("stack-file"))
 	viper.BindPFlag("stack.deploy.endpoint", stackDeployCmd.Flags().Lookup("endpoint"))
 	viper.BindPFlag("stack.deploy.env-file", stackDeployCmd.Flags().Lookup("env-file"))
 	viper.BindPFlag("stack.deploy.replace-env", stackDeployCmd.Flags().Lookup("replace-env"))
+	viper.BindPFlag("stack.deploy.env-strategy", stackDeployCmd.Flags().Lookup("env-strategy"))
 	viper.BindPFlag("stack.deploy.prune", stackDeployCmd.Flags().Lookup("prune"))
+	viper.BindPFlag("stack.deploy.wait", stackDeployCmd.Flags().Lookup("wait"))
+	viper.BindPFlag("stack.deploy.wait-timeout", stackDeployCmd.Flags().Lookup("wait-timeout"))
+	viper.BindPFlag("stack.deploy.atomic", stackDeployCmd.Flags().Lookup("atomic"))
+	viper.BindPFlag("stack.deploy.lock", stackDeployCmd.Flags().Lookup("lock"))
+	viper.BindPFlag("stack.deploy.lock-timeout", stackDeployCmd.Flags().Lookup("lock-timeout"))
+	viper.BindPFlag("stack.deploy.lock-ttl", stackDeployCmd.Flags().Lookup("lock-ttl"))
+	viper.BindPFlag("stack.deploy.lock-owner", stackDeployCmd.Flags().Lookup("lock-owner"))
+	viper.BindPFlag("stack.deploy.access", stackDeployCmd.Flags().Lookup("access"))
+	viper.BindPFlag("stack.deploy.users", stackDeployCmd.Flags().Lookup("users"))
+	viper.BindPFlag("stack.deploy.teams", stackDeployCmd.Flags().Lookup("teams"))
+	viper.BindPFlag("stack.deploy.keep-x-psu", stackDeployCmd.Flags().Lookup("keep-x-psu"))
+}
+
+// Stack deployment actions
+const (
+	stackDeployActionCreate = "create"
+	stackDeployActionUpdate = "update"
+)
+
+// Stack deployment hook stages
+const (
+	deployHookStagePre  = "pre-deploy"
+	deployHookStagePost = "post-deploy"
+)
+
+// isStackDeployWaitEnabled checks if stack convergence must be awaited after deploying it
+func isStackDeployWaitEnabled() bool {
+	return viper.GetBool("stack.deploy.wait") || viper.GetBool("stack.deploy.atomic")
+}
+
+// removeFailedStack removes a stack whose creation failed, if it was created at all
+func removeFailedStack(stackName, swarmClusterID string, endpoint portainer.Endpoint) (err error) {
+	portainerClient, err := common.GetClient()
+	if err != nil {
+		return
+	}
+
+	stack, err := common.GetStackByName(stackName, swarmClusterID, endpoint.ID)
+	if err == common.ErrStackNotFound {
+		logrus.WithFields(logrus.Fields{
+			"stack":    stackName,
+			"endpoint": endpoint.Name,
+		}).Debug("Stack was not created")
+		return nil
+	} else if err != nil {
+		return
+	}
+
+	return portainerClient.StackDelete(stack.ID)
+}
+
+// reportAtomicDeploymentFailure exits reporting both a failed atomic
+// deployment and the outcome of its rollback
+func reportAtomicDeploymentFailure(stackName, rollbackImplications string, deploymentErr, rollbackErr error) {
+	if rollbackErr != nil {
+		logrus.WithFields(logrus.Fields{
+			"stack":            stackName,
+			"message":          deploymentErr.Error(),
+			"rollback-message": rollbackErr.Error(),
+			"implications":     "The stack may be left in an inconsistent state",
+		}).Fatal("stack deployment failed, and rollback failed too")
+	}
+	logrus.WithFields(logrus.Fields{
+		"stack":        stackName,
+		"message":      deploymentErr.Error(),
+		"implications": rollbackImplications,
+	}).Fatal("stack deployment failed, rolled back")
+}
+
+// getDeployHooks returns the hooks of a deployment stage. Hooks set through
+// command line flags (or global settings) take precedence over the ones set
+// for the stack in the settings file under the "stack.deploy.hooks" map.
+func getDeployHooks(cmd *cobra.Command, stage, stackName string) (hooks []string) {
+	// Hook flags are not bound to viper, as it does not support string array
+	// flags (hook commands may contain commas)
+	hooks, _ = cmd.Flags().GetStringArray(fmt.Sprintf("%s-hook", stage))
+	if len(hooks) == 0 {
+		hooks = viper.GetStringSlice(fmt.Sprintf("stack.deploy.%s-hook", stage))
+	}
+	if len(hooks) == 0 {
+		hooks = common.GetStackDeployHooks(stackName, stage)
+	}
+	return
 }
 
+// runDeployHooks runs the hooks of a deployment stage. Pre-deploy hook
+// failures abort the deployment, and post-deploy hook failures make the
+// program fail after the deployment.
+func runDeployHooks(hooks []string, stage, action, stackName string, stackID portainer.StackID, endpoint portainer.Endpoint, deploymentErr error) {
+	if len(hooks) == 0 {
+		return
+	}
+
+	environmentVariables := map[string]string{
+		"PSU_STACK":         stackName,
+		"PSU_ENDPOINT":      endpoint.Name,
+		"PSU_DEPLOY_ACTION": action,
+		"PSU_DEPLOY_STAGE":  stage,
+	}
+	if stackID != 0 {
+		environmentVariables["PSU_STACK_ID"] = fmt.Sprint(stackID)
+	}
+	if stage == deployHookStagePost {
+		if deploymentErr == nil {
+			environmentVariables["PSU_DEPLOY_RESULT"] = "success"
+		} else {
+			environmentVariables["PSU_DEPLOY_RESULT"] = "failure"
+			environmentVariables["PSU_DEPLOY_ERROR"] = deploymentErr.Error()
+		}
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"stack": stackName,
+		"stage": stage,
+	}).Info("Running deployment hooks")
+	err := common.RunHooks(hooks, environmentVariables)
+	if err != nil && deploymentErr != nil {
+		// Report the hook failure without hiding the deployment one
+		logrus.WithFields(logrus.Fields{
+			"stack":   stackName,
+			"stage":   stage,
+			"message": err.Error(),
+		}).Error("Deployment hook failed")
+		return
+	}
+	common.CheckError(err)
+}
+
+// loadStackFile loads a stack file, resolving its references to other local
+// files so it can be uploaded as a self-contained document
 func loadStackFile(path string) (string, error) {
-	loadedStackFileContentBytes, readingErr := ioutil.ReadFile(path)
-	if readingErr != nil {
-		return "", readingErr
+	return common.ResolveStackFile(path)
+}
+
+// prepareStackFile loads a stack file, strips its x-psu block (unless
+// keepExtension is set) and prepares the configs and secrets to create from
+// the local files it references
+func prepareStackFile(stackName, path string, swarm, keepExtension bool) (content string, sources []common.StackFileSource, err error) {
+	content, err = loadStackFile(path)
+	if err != nil {
+		return
+	}
+	if !keepExtension {
+		content, err = common.StripStackFileExtension(content)
+		if err != nil {
+			return
+		}
+	}
+	return common.PrepareStackFileSources(stackName, path, content, swarm)
+}
+
+// applyStackFileExtension reads a stack file's x-psu block (if any), checks
+// the psu version it requires, and sets its endpoint, access and prune
+// values as defaults for the deploy command (so flags and settings take
+// precedence over them). It returns its default environment variables.
+func applyStackFileExtension(path string) (defaultEnvironmentVariables []portainer.Pair, err error) {
+	extension, found, err := loadStackFileExtension(path)
+	if err != nil || !found {
+		return
+	}
+
+	if extension.Endpoint != "" {
+		viper.SetDefault("stack.deploy.endpoint", extension.Endpoint)
+	}
+	if extension.Access != "" {
+		viper.SetDefault("stack.deploy.access", extension.Access)
+	}
+	if extension.Prune != nil {
+		viper.SetDefault("stack.deploy.prune", *extension.Prune)
+	}
+
+	return getStackFileExtensionEnvironmentVariables(extension), nil
+}
+
+// loadStackFileExtension reads a stack file's x-psu block (if any) and
+// checks the psu version it requires
+func loadStackFileExtension(path string) (extension common.StackFileExtension, found bool, err error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
 	}
-	return string(loadedStackFileContentBytes), nil
+	extension, found, err = common.GetStackFileExtension(string(content))
+	if err != nil || !found {
+		return
+	}
+	logrus.WithFields(logrus.Fields{
+		"file": path,
+	}).Debug(fmt.Sprintf("Using stack file %s block", common.StackFileExtensionKey))
+
+	if extension.PsuVersion != "" {
+		if currentVersion := version.Version(); currentVersion == "" {
+			logrus.WithFields(logrus.Fields{
+				"required":     extension.PsuVersion,
+				"implications": "The stack file may use features not available in this build",
+			}).Warning("Not checking required psu version in a snapshot build")
+		} else {
+			satisfied, checkingErr := common.CheckVersionConstraint(currentVersion, extension.PsuVersion)
+			if checkingErr != nil {
+				err = checkingErr
+				return
+			}
+			if !satisfied {
+				err = fmt.Errorf("stack file %s requires psu version %s, but this is version %s", path, extension.PsuVersion, currentVersion)
+				return
+			}
+		}
+	}
+	return
+}
+
+// getStackFileExtensionEnvironmentVariables returns an x-psu block's default
+// environment variables, sorted by name
+func getStackFileExtensionEnvironmentVariables(extension common.StackFileExtension) (defaultEnvironmentVariables []portainer.Pair) {
+	for name, value := range extension.Env {
+		defaultEnvironmentVariables = append(defaultEnvironmentVariables, portainer.Pair{
+			Name:  name,
+			Value: value,
+		})
+	}
+	sort.Slice(defaultEnvironmentVariables, func(i, j int) bool {
+		return defaultEnvironmentVariables[i].Name < defaultEnvironmentVariables[j].Name
+	})
+	return
+}
+
+// addDefaultEnvironmentVariables adds default values for the environment
+// variables which are not set after merging them, updating the changes
+// made by the merge
+func addDefaultEnvironmentVariables(variables, defaults []portainer.Pair, changes common.EnvironmentVariablesChanges) ([]portainer.Pair, common.EnvironmentVariablesChanges) {
+	merged, defaultsChanges, _ := common.MergeEnvironmentVariables(variables, defaults, common.EnvStrategyKeepExisting)
+
+	removed := map[string]bool{}
+	for _, name := range changes.Removed {
+		removed[name] = true
+	}
+	for _, name := range defaultsChanges.Added {
+		if !removed[name] {
+			changes.Added = append(changes.Added, name)
+			continue
+		}
+		// A removed variable is being set to its default value instead
+		removed[name] = false
+		changes.Changed = append(changes.Changed, name)
+	}
+	changes.Removed = nil
+	for name, isRemoved := range removed {
+		if isRemoved {
+			changes.Removed = append(changes.Removed, name)
+		}
+	}
+
+	sort.Strings(changes.Added)
+	sort.Strings(changes.Changed)
+	sort.Strings(changes.Removed)
+	return merged, changes
+}
+
+// getStackDeployAccessControl returns the access control to set on the
+// deployed stack, and whether it was requested at all
+func getStackDeployAccessControl() (accessControl common.AccessControl, requested bool, err error) {
+	mode := viper.GetString("stack.deploy.access")
+	userNames := viper.GetStringSlice("stack.deploy.users")
+	teamNames := viper.GetStringSlice("stack.deploy.teams")
+	if mode == "" && len(userNames) == 0 && len(teamNames) == 0 {
+		return
+	}
+	accessControl, err = common.GetAccessControl(mode, userNames, teamNames)
+	return accessControl, true, err
+}
+
+// setStackDeployAccess sets the access control of a deployed stack. Existing
+// stacks are left untouched if they already have the same access control.
+func setStackDeployAccess(stackName string, endpoint portainer.Endpoint, accessControl common.AccessControl, existingStack bool) error {
+	if existingStack {
+		logrus.WithFields(logrus.Fields{
+			"stack":    stackName,
+			"endpoint": endpoint.Name,
+		}).Debug("Getting stack access control info")
+		resourceControl, err := common.GetStackPortainerAccessControl(endpoint.ID, stackName)
+		if err != nil && err != common.ErrAccessControlNotFound {
+			return err
+		}
+		if accessControl.Matches(resourceControl, err == nil) {
+			logrus.WithFields(logrus.Fields{
+				"stack":    stackName,
+				"endpoint": endpoint.Name,
+			}).Debug("Stack access control unchanged")
+			return nil
+		}
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"stack":    stackName,
+		"endpoint": endpoint.Name,
+	}).Info("Setting stack access control")
+	return common.SetPortainerAccessControl(endpoint.ID, stackName, client.ResourceStack, accessControl)
 }
 
 // Load environment variables
@@ -219,6 +664,26 @@ func loadEnvironmentVariablesFile(path string) ([]portainer.Pair, error) {
 			Value: value,
 		})
 	}
+	sort.Slice(variables, func(i, j int) bool {
+		return variables[i].Name < variables[j].Name
+	})
 
 	return variables, nil
 }
+
+// logEnvironmentVariablesChanges reports which stack environment variables
+// are being added, changed and removed (without their values)
+func logEnvironmentVariablesChanges(stackName string, changes common.EnvironmentVariablesChanges) {
+	if changes.IsEmpty() {
+		logrus.WithFields(logrus.Fields{
+			"stack": stackName,
+		}).Info("Environment variables unchanged")
+		return
+	}
+	logrus.WithFields(logrus.Fields{
+		"stack":   stackName,
+		"added":   strings.Join(changes.Added, ","),
+		"changed": strings.Join(changes.Changed, ","),
+		"removed": strings.Join(changes.Removed, ","),
+	}).Info("Environment variables changed")
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"github.com/greenled/portainer-stack-utils/client"
+	"github.com/greenled/portainer-stack-utils/common"
+	portainer "github.com/portainer/portainer/api"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// stackEnvCmd represents the stack env command
+var stackEnvCmd = &cobra.Command{
+	Use:   "env",
+	Short: "Manage stack environment variables",
+}
+
+func init() {
+	stackCmd.AddCommand(stackEnvCmd)
+}
+
+// getStackInEndpoint retrieves a stack by its name from an endpoint (or the
+// only available endpoint if no endpoint name is given)
+func getStackInEndpoint(stackName, endpointName string) (stack portainer.Stack, endpoint portainer.Endpoint) {
+	if endpointName == "" {
+		// Guess endpoint if not set
+		logrus.WithFields(logrus.Fields{
+			"implications": "Command will fail if there is not exactly one endpoint available",
+		}).Warning("Endpoint not set")
+		var endpointRetrievalErr error
+		endpoint, endpointRetrievalErr = common.GetDefaultEndpoint()
+		common.CheckError(endpointRetrievalErr)
+		logrus.WithFields(logrus.Fields{
+			"endpoint": endpoint.Name,
+		}).Debug("Using the only available endpoint")
+	} else {
+		// Get endpoint by name
+		var endpointRetrievalErr error
+		endpoint, endpointRetrievalErr = common.GetEndpointByName(endpointName)
+		common.CheckError(endpointRetrievalErr)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"endpoint": endpoint.Name,
+	}).Debug("Getting endpoint's Docker info")
+	endpointSwarmClusterID, selectionErr := common.GetEndpointSwarmClusterID(endpoint.ID)
+	if selectionErr == nil {
+		// It's a swarm cluster
+	} else if selectionErr == common.ErrStackClusterNotFound {
+		// It's not a swarm cluster
+	} else {
+		// Something else happened
+		common.CheckError(selectionErr)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"stack":    stackName,
+		"endpoint": endpoint.Name,
+	}).Debug("Getting stack")
+	stack, stackRetrievalErr := common.GetStackByName(stackName, endpointSwarmClusterID, endpoint.ID)
+	if stackRetrievalErr == common.ErrStackNotFound {
+		logrus.WithFields(logrus.Fields{
+			"stack":    stackName,
+			"endpoint": endpoint.Name,
+		}).Fatal("Stack not found")
+	}
+	common.CheckError(stackRetrievalErr)
+
+	return
+}
+
+// updateStackEnvironmentVariables redeploys a stack with its current stack
+// file and a new set of environment variables
+func updateStackEnvironmentVariables(stack portainer.Stack, endpoint portainer.Endpoint, environmentVariables []portainer.Pair) {
+	portainerClient, clientRetrievalErr := common.GetClient()
+	common.CheckError(clientRetrievalErr)
+
+	logrus.WithFields(logrus.Fields{
+		"stack": stack.Name,
+	}).Debug("Getting stack file content")
+	stackFileContent, stackFileContentRetrievalErr := portainerClient.StackFileInspect(stack.ID)
+	common.CheckError(stackFileContentRetrievalErr)
+
+	logrus.WithFields(logrus.Fields{
+		"stack": stack.Name,
+	}).Info("Updating stack")
+	err := portainerClient.StackUpdate(client.StackUpdateOptions{
+		Stack:                stack,
+		EnvironmentVariables: environmentVariables,
+		StackFileContent:     stackFileContent,
+		EndpointID:           endpoint.ID,
+	})
+	common.CheckError(err)
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// stackEnvGetCmd represents the stack env get command
+var stackEnvGetCmd = &cobra.Command{
+	Use:     "get <stack> <name>",
+	Short:   "Get a stack environment variable",
+	Example: "  psu stack env get mystack MYSQL_ROOT_PASSWORD",
+	Args:    cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		stack, endpoint := getStackInEndpoint(args[0], viper.GetString("stack.env.get.endpoint"))
+
+		for _, variable := range stack.Env {
+			if variable.Name == args[1] {
+				fmt.Println(variable.Value)
+				return
+			}
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"stack":    stack.Name,
+			"endpoint": endpoint.Name,
+			"variable": args[1],
+		}).Fatal("environment variable not found")
+	},
+}
+
+func init() {
+	stackEnvCmd.AddCommand(stackEnvGetCmd)
+
+	stackEnvGetCmd.Flags().String("endpoint", "", "Endpoint name.")
+	viper.BindPFlag("stack.env.get.endpoint", stackEnvGetCmd.Flags().Lookup("endpoint"))
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/template"
+
+	"github.com/greenled/portainer-stack-utils/common"
+	portainer "github.com/portainer/portainer/api"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// maskedEnvironmentVariableValue replaces environment variable values when they are not shown
+const maskedEnvironmentVariableValue = "********"
+
+// stackEnvListCmd represents the stack env list command
+var stackEnvListCmd = &cobra.Command{
+	Use:     "list <stack>",
+	Short:   "List stack environment variables",
+	Aliases: []string{"ls"},
+	Example: `  Print environment variables of a stack in a table format, with masked values:
+  psu stack env ls mystack
+
+  Print environment variables of a stack in a dotenv format:
+  psu stack env ls mystack --show-values --format "{{ .Name }}={{ .Value }}"`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		stack, _ := getStackInEndpoint(args[0], viper.GetString("stack.env.list.endpoint"))
+
+		environmentVariables := []portainer.Pair{}
+		for _, variable := range stack.Env {
+			if !viper.GetBool("stack.env.list.show-values") {
+				variable.Value = maskedEnvironmentVariableValue
+			}
+			environmentVariables = append(environmentVariables, variable)
+		}
+
+		switch viper.GetString("stack.env.list.format") {
+		case "table":
+			// Print environment variables in a table format
+			writer, err := common.NewTabWriter([]string{
+				"NAME",
+				"VALUE",
+			})
+			common.CheckError(err)
+			for _, v := range environmentVariables {
+				_, err := fmt.Fprintln(writer, fmt.Sprintf(
+					"%s\t%s",
+					v.Name,
+					v.Value,
+				))
+				common.CheckError(err)
+			}
+			flushErr := writer.Flush()
+			common.CheckError(flushErr)
+		case "json":
+			// Print environment variables in a json format
+			environmentVariablesJSONBytes, err := json.Marshal(environmentVariables)
+			common.CheckError(err)
+			fmt.Println(string(environmentVariablesJSONBytes))
+		default:
+			// Print environment variables in a custom format
+			template, templateParsingErr := template.New("environmentVariableTpl").Parse(viper.GetString("stack.env.list.format"))
+			common.CheckError(templateParsingErr)
+			for _, v := range environmentVariables {
+				templateExecutionErr := template.Execute(os.Stdout, v)
+				common.CheckError(templateExecutionErr)
+				fmt.Println()
+			}
+		}
+	},
+}
+
+func init() {
+	stackEnvCmd.AddCommand(stackEnvListCmd)
+
+	stackEnvListCmd.Flags().String("endpoint", "", "Endpoint name.")
+	stackEnvListCmd.Flags().Bool("show-values", false, "Show environment variable values instead of masking them.")
+	stackEnvListCmd.Flags().String("format", "table", `Output format. Can be "table", "json" or a Go template.`)
+	viper.BindPFlag("stack.env.list.endpoint", stackEnvListCmd.Flags().Lookup("endpoint"))
+	viper.BindPFlag("stack.env.list.show-values", stackEnvListCmd.Flags().Lookup("show-values"))
+	viper.BindPFlag("stack.env.list.format", stackEnvListCmd.Flags().Lookup("format"))
+
+	stackEnvListCmd.SetUsageTemplate(stackEnvListCmd.UsageTemplate() + common.GetFormatHelp(portainer.Pair{}))
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/greenled/portainer-stack-utils/common"
+	portainer "github.com/portainer/portainer/api"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// stackEnvSetCmd represents the stack env set command
+var stackEnvSetCmd = &cobra.Command{
+	Use:   "set <stack> <name=value>...",
+	Short: "Set stack environment variables",
+	Long:  "Set stack environment variables, redeploying the stack with its current stack file.",
+	Example: `  Rotate a password:
+  psu stack env set mystack MYSQL_ROOT_PASSWORD=anewgoodpassword`,
+	Args: cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		var newEnvironmentVariables []portainer.Pair
+		for _, arg := range args[1:] {
+			nameAndValue := strings.SplitN(arg, "=", 2)
+			if len(nameAndValue) != 2 || nameAndValue[0] == "" {
+				logrus.WithFields(logrus.Fields{
+					"variable":    arg,
+					"suggestions": fmt.Sprintf("use NAME=VALUE syntax: psu stack env set %s NAME=VALUE", args[0]),
+				}).Fatal("invalid environment variable")
+			}
+			newEnvironmentVariables = append(newEnvironmentVariables, portainer.Pair{
+				Name:  nameAndValue[0],
+				Value: nameAndValue[1],
+			})
+		}
+
+		stack, endpoint := getStackInEndpoint(args[0], viper.GetString("stack.env.set.endpoint"))
+
+		environmentVariables, environmentVariablesChanges, mergingErr := common.MergeEnvironmentVariables(stack.Env, newEnvironmentVariables, common.EnvStrategyMerge)
+		common.CheckError(mergingErr)
+		logEnvironmentVariablesChanges(stack.Name, environmentVariablesChanges)
+		if environmentVariablesChanges.IsEmpty() {
+			return
+		}
+
+		updateStackEnvironmentVariables(stack, endpoint, environmentVariables)
+	},
+}
+
+func init() {
+	stackEnvCmd.AddCommand(stackEnvSetCmd)
+
+	stackEnvSetCmd.Flags().String("endpoint", "", "Endpoint name.")
+	viper.BindPFlag("stack.env.set.endpoint", stackEnvSetCmd.Flags().Lookup("endpoint"))
+}
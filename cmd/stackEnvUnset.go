@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"github.com/greenled/portainer-stack-utils/common"
+	portainer "github.com/portainer/portainer/api"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// stackEnvUnsetCmd represents the stack env unset command
+var stackEnvUnsetCmd = &cobra.Command{
+	Use:     "unset <stack> <name>...",
+	Short:   "Unset stack environment variables",
+	Long:    "Unset stack environment variables, redeploying the stack with its current stack file.",
+	Example: "  psu stack env unset mystack DEBUG",
+	Args:    cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		stack, endpoint := getStackInEndpoint(args[0], viper.GetString("stack.env.unset.endpoint"))
+
+		unsetNames := map[string]bool{}
+		for _, name := range args[1:] {
+			unsetNames[name] = true
+		}
+
+		environmentVariables := []portainer.Pair{}
+		var environmentVariablesChanges common.EnvironmentVariablesChanges
+		for _, variable := range stack.Env {
+			if unsetNames[variable.Name] {
+				environmentVariablesChanges.Removed = append(environmentVariablesChanges.Removed, variable.Name)
+				delete(unsetNames, variable.Name)
+				continue
+			}
+			environmentVariables = append(environmentVariables, variable)
+		}
+
+		for name := range unsetNames {
+			logFields := logrus.Fields{
+				"stack":    stack.Name,
+				"endpoint": endpoint.Name,
+				"variable": name,
+			}
+			if viper.GetBool("stack.env.unset.strict") {
+				logrus.WithFields(logFields).Fatal("environment variable not found")
+			}
+			logrus.WithFields(logFields).Warning("Environment variable not found")
+		}
+
+		logEnvironmentVariablesChanges(stack.Name, environmentVariablesChanges)
+		if environmentVariablesChanges.IsEmpty() {
+			return
+		}
+
+		updateStackEnvironmentVariables(stack, endpoint, environmentVariables)
+	},
+}
+
+func init() {
+	stackEnvCmd.AddCommand(stackEnvUnsetCmd)
+
+	stackEnvUnsetCmd.Flags().String("endpoint", "", "Endpoint name.")
+	stackEnvUnsetCmd.Flags().Bool("strict", false, "Fail if an environment variable does not exist.")
+	viper.BindPFlag("stack.env.unset.endpoint", stackEnvUnsetCmd.Flags().Lookup("endpoint"))
+	viper.BindPFlag("stack.env.unset.strict", stackEnvUnsetCmd.Flags().Lookup("strict"))
+}
@@ -2,7 +2,12 @@ package cmd
 
 import (
 	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
 
+	"github.com/greenled/portainer-stack-utils/client"
 	"github.com/greenled/portainer-stack-utils/common"
 	portainer "github.com/portainer/portainer/api"
 	"github.com/sirupsen/logrus"
@@ -12,19 +17,36 @@ import (
 
 // stackRemoveCmd represents the remove command
 var stackRemoveCmd = &cobra.Command{
-	Use:     "remove <name>",
-	Short:   "Remove a stack",
+	Use:     "remove <name|pattern>...",
+	Short:   "Remove one or more stacks",
 	Aliases: []string{"rm", "down"},
-	Example: "  psu stack rm mystack",
-	Args:    cobra.ExactArgs(1),
+	Example: `  Remove a stack:
+  psu stack rm mystack
+
+  Remove several stacks:
+  psu stack rm mystack myotherstack
+
+  Remove all stacks whose name matches a glob pattern, without asking for confirmation:
+  psu stack rm "review-*" --endpoint primary --yes
+
+  Remove all stacks in an endpoint:
+  psu stack rm --all --endpoint primary
+
+  Remove a stack along with its named volumes, configs and secrets:
+  psu stack rm mystack --volumes --configs-secrets`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if viper.GetBool("stack.remove.all") {
+			if len(args) > 0 {
+				return fmt.Errorf("stack names can not be used along with --all flag")
+			}
+			return nil
+		}
+		return cobra.MinimumNArgs(1)(cmd, args)
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		portainerClient, clientRetrievalErr := common.GetClient()
 		common.CheckError(clientRetrievalErr)
 
-		stackName := args[0]
-		var endpointSwarmClusterID string
-		var stack portainer.Stack
-
 		var endpoint portainer.Endpoint
 		if endpointName := viper.GetString("stack.remove.endpoint"); endpointName == "" {
 			// Guess endpoint if not set
@@ -48,57 +70,144 @@ var stackRemoveCmd = &cobra.Command{
 		logrus.WithFields(logrus.Fields{
 			"endpoint": endpoint.Name,
 		}).Debug("Getting endpoint's Docker info")
-		var selectionErr, stackRetrievalErr error
-		endpointSwarmClusterID, selectionErr = common.GetEndpointSwarmClusterID(endpoint.ID)
+		endpointSwarmClusterID, selectionErr := common.GetEndpointSwarmClusterID(endpoint.ID)
 		if selectionErr == nil {
 			// It's a swarm cluster
-			logrus.WithFields(logrus.Fields{
-				"stack":    stackName,
-				"endpoint": endpoint.Name,
-			}).Debug("Getting stack")
-			stack, stackRetrievalErr = common.GetStackByName(stackName, endpointSwarmClusterID, endpoint.ID)
 		} else if selectionErr == common.ErrStackClusterNotFound {
 			// It's not a swarm cluster
-			logrus.WithFields(logrus.Fields{
-				"stack":    stackName,
-				"endpoint": endpoint.Name,
-			}).Debug("Getting stack")
-			stack, stackRetrievalErr = common.GetStackByName(stackName, "", endpoint.ID)
 		} else {
 			// Something else happened
 			common.CheckError(selectionErr)
 		}
 
-		if stackRetrievalErr == nil {
-			// The stack exists
-			stackID := stack.ID
+		logrus.WithFields(logrus.Fields{
+			"endpoint": endpoint.Name,
+		}).Debug("Getting stacks")
+		endpointStacks, stacksRetrievalErr := portainerClient.StackList(client.StackListOptions{
+			Filter: client.StackListFilter{
+				SwarmID:    endpointSwarmClusterID,
+				EndpointID: endpoint.ID,
+			},
+		})
+		common.CheckError(stacksRetrievalErr)
+
+		var stacks []portainer.Stack
+		if viper.GetBool("stack.remove.all") {
+			stacks = endpointStacks
+		} else {
+			var selectionErr error
+			stacks, selectionErr = selectStacks(endpointStacks, args)
+			common.CheckError(selectionErr)
 
+			for _, stackName := range args {
+				if isStackNamePattern(stackName) || stackListContains(stacks, stackName) {
+					continue
+				}
+				// The stack does not exist
+				logrus.WithFields(logrus.Fields{
+					"stack":    stackName,
+					"endpoint": endpoint.Name,
+				}).Debug("Stack not found")
+				if viper.GetBool("stack.remove.strict") {
+					logrus.WithFields(logrus.Fields{
+						"stack":       stackName,
+						"endpoint":    endpoint.Name,
+						"suggestions": fmt.Sprintf("try with a different endpoint: psu stack rm %s --endpoint ENDPOINT_NAME", stackName),
+					}).Fatal("stack does not exist")
+				}
+			}
+		}
+
+		if len(stacks) == 0 {
 			logrus.WithFields(logrus.Fields{
-				"stack":    stackName,
 				"endpoint": endpoint.Name,
-			}).Info("Removing stack")
-			err := portainerClient.StackDelete(stackID)
+			}).Info("No stacks to remove")
+			return
+		}
+
+		// Bulk removals need to be confirmed, unless told otherwise
+		isBulkRemoval := viper.GetBool("stack.remove.all") || len(args) > 1 || isStackNamePattern(args[0])
+		if isBulkRemoval && !viper.GetBool("stack.remove.yes") {
+			fmt.Println("The following stacks will be removed:")
+			writer, err := common.NewTabWriter([]string{
+				"ID",
+				"NAME",
+				"TYPE",
+				"ENDPOINT",
+			})
 			common.CheckError(err)
+			for _, s := range stacks {
+				_, err = fmt.Fprintln(writer, fmt.Sprintf(
+					"%v\t%s\t%v\t%s",
+					s.ID,
+					s.Name,
+					client.GetTranslatedStackType(s.Type),
+					endpoint.Name,
+				))
+				common.CheckError(err)
+			}
+			flushErr := writer.Flush()
+			common.CheckError(flushErr)
+
+			confirmed, confirmationErr := common.Confirm(fmt.Sprintf("Remove %d stack(s)?", len(stacks)))
+			common.CheckError(confirmationErr)
+			if !confirmed {
+				logrus.WithFields(logrus.Fields{
+					"suggestions": "use --yes flag to skip confirmation",
+				}).Fatal("stack removal not confirmed")
+			}
+		}
+
+		var removedStacks, failedStacks []string
+		for _, stack := range stacks {
 			logrus.WithFields(logrus.Fields{
 				"stack":    stack.Name,
 				"endpoint": endpoint.Name,
-			}).Info("Stack removed")
-		} else if stackRetrievalErr == common.ErrStackNotFound {
-			// The stack does not exist
+			}).Info("Removing stack")
+			startedAt := time.Now()
+			err := portainerClient.StackDelete(stack.ID)
+			if err != nil {
+				common.Notify(common.NewNotification(common.NotificationActionRemove, stack.Name, endpoint.Name, startedAt, err))
+				logrus.WithFields(logrus.Fields{
+					"stack":    stack.Name,
+					"endpoint": endpoint.Name,
+					"message":  err.Error(),
+				}).Error("Stack removal failed")
+				failedStacks = append(failedStacks, stack.Name)
+				continue
+			}
 			logrus.WithFields(logrus.Fields{
-				"stack":    stackName,
+				"stack":    stack.Name,
 				"endpoint": endpoint.Name,
-			}).Debug("Stack not found")
-			if viper.GetBool("stack.remove.strict") {
+			}).Info("Stack removed")
+
+			err = removeStackResources(endpoint, stack)
+			common.Notify(common.NewNotification(common.NotificationActionRemove, stack.Name, endpoint.Name, startedAt, err))
+			if err != nil {
 				logrus.WithFields(logrus.Fields{
-					"stack":       stackName,
-					"endpoint":    endpoint.Name,
-					"suggestions": fmt.Sprintf("try with a different endpoint: psu stack rm %s --endpoint ENDPOINT_NAME", stackName),
-				}).Fatal("stack does not exist")
+					"stack":    stack.Name,
+					"endpoint": endpoint.Name,
+					"message":  err.Error(),
+				}).Error("Stack resources removal failed")
+				failedStacks = append(failedStacks, stack.Name)
+				continue
 			}
-		} else {
-			// Something else happened
-			common.CheckError(stackRetrievalErr)
+			removedStacks = append(removedStacks, stack.Name)
+		}
+
+		if isBulkRemoval {
+			logrus.WithFields(logrus.Fields{
+				"endpoint": endpoint.Name,
+				"removed":  strings.Join(removedStacks, ","),
+				"failed":   strings.Join(failedStacks, ","),
+			}).Info(fmt.Sprintf("%d stack(s) removed, %d failed", len(removedStacks), len(failedStacks)))
+		}
+
+		if len(failedStacks) > 0 {
+			logrus.WithFields(logrus.Fields{
+				"stacks":   strings.Join(failedStacks, ","),
+				"endpoint": endpoint.Name,
+			}).Fatal("some stacks could not be removed")
 		}
 	},
 }
@@ -106,8 +215,136 @@ var stackRemoveCmd = &cobra.Command{
 func init() {
 	stackCmd.AddCommand(stackRemoveCmd)
 
-	stackRemoveCmd.Flags().Bool("strict", false, "Fail if stack does not exist.")
+	stackRemoveCmd.Flags().Bool("strict", false, "Fail if a stack does not exist.")
 	stackRemoveCmd.Flags().String("endpoint", "", "Endpoint name.")
+	stackRemoveCmd.Flags().Bool("all", false, "Remove all stacks in the endpoint.")
+	stackRemoveCmd.Flags().BoolP("yes", "y", false, "Do not ask for confirmation before removing several stacks.")
+	stackRemoveCmd.Flags().Bool("volumes", false, "Remove the named volumes created for the stack.")
+	stackRemoveCmd.Flags().Bool("configs-secrets", false, "Remove the configs and secrets created for the stack (only available for Swarm stacks).")
+	stackRemoveCmd.Flags().Duration("resources-timeout", time.Minute, "Waiting time for the stack resources to be released before giving up on removing them (like 30s, 5m).")
 	viper.BindPFlag("stack.remove.strict", stackRemoveCmd.Flags().Lookup("strict"))
 	viper.BindPFlag("stack.remove.endpoint", stackRemoveCmd.Flags().Lookup("endpoint"))
+	viper.BindPFlag("stack.remove.all", stackRemoveCmd.Flags().Lookup("all"))
+	viper.BindPFlag("stack.remove.yes", stackRemoveCmd.Flags().Lookup("yes"))
+	viper.BindPFlag("stack.remove.volumes", stackRemoveCmd.Flags().Lookup("volumes"))
+	viper.BindPFlag("stack.remove.configs-secrets", stackRemoveCmd.Flags().Lookup("configs-secrets"))
+	viper.BindPFlag("stack.remove.resources-timeout", stackRemoveCmd.Flags().Lookup("resources-timeout"))
+}
+
+// isStackNamePattern checks if a stack name contains glob pattern characters
+func isStackNamePattern(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
+// selectStacks returns the stacks whose name matches any of the given names
+// or glob patterns, keeping the order of the stack list
+func selectStacks(stacks []portainer.Stack, patterns []string) (selectedStacks []portainer.Stack, err error) {
+	for _, stack := range stacks {
+		for _, pattern := range patterns {
+			matches, matchingErr := path.Match(pattern, stack.Name)
+			if matchingErr != nil {
+				err = fmt.Errorf("invalid stack name pattern %q: %s", pattern, matchingErr)
+				return
+			}
+			if matches {
+				selectedStacks = append(selectedStacks, stack)
+				break
+			}
+		}
+	}
+	return
+}
+
+// stackListContains checks if a stack with a given name is in a list of stacks
+func stackListContains(stacks []portainer.Stack, name string) bool {
+	for _, stack := range stacks {
+		if stack.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// removeStackResources removes the volumes, configs and secrets labelled with
+// a (just removed) stack's namespace, as requested by the command flags.
+// Resources still in use (i.e. while Swarm tears down the stack tasks) are
+// retried until they are released or the timeout expires.
+func removeStackResources(endpoint portainer.Endpoint, stack portainer.Stack) error {
+	var resourceTypes []client.ResourceType
+	if viper.GetBool("stack.remove.volumes") {
+		resourceTypes = append(resourceTypes, client.ResourceVolume)
+	}
+	if viper.GetBool("stack.remove.configs-secrets") {
+		if stack.Type == portainer.DockerSwarmStack {
+			resourceTypes = append(resourceTypes, client.ResourceConfig, client.ResourceSecret)
+		} else {
+			logrus.WithFields(logrus.Fields{
+				"stack":        stack.Name,
+				"implications": "Configs and secrets are only available for Swarm stacks",
+			}).Warning("Not removing stack configs and secrets")
+		}
+	}
+	if len(resourceTypes) == 0 {
+		return nil
+	}
+
+	namespaceLabel := common.GetStackNamespaceLabel(stack)
+
+	var pendingResources []common.DockerResource
+	for _, resourceType := range resourceTypes {
+		logrus.WithFields(logrus.Fields{
+			"stack":    stack.Name,
+			"endpoint": endpoint.Name,
+		}).Debug(fmt.Sprintf("Getting stack %ss", resourceType))
+		resources, err := common.GetDockerResources(endpoint.ID, resourceType, namespaceLabel)
+		if err != nil {
+			return err
+		}
+		pendingResources = append(pendingResources, resources...)
+		if resourceType == client.ResourceConfig || resourceType == client.ResourceSecret {
+			// Configs and secrets created from local files referenced by the stack file
+			sources, err := common.GetDockerResources(endpoint.ID, resourceType, fmt.Sprintf("%s=%s", common.StackFileSourceStackLabel, stack.Name))
+			if err != nil {
+				return err
+			}
+			pendingResources = append(pendingResources, sources...)
+		}
+	}
+
+	deadline := time.Now().Add(viper.GetDuration("stack.remove.resources-timeout"))
+	for {
+		var stillPendingResources []common.DockerResource
+		var lastErr error
+		for _, resource := range pendingResources {
+			err := common.RemoveDockerResource(endpoint.ID, resource.Type, resource.ID)
+			if genericError, isGenericError := err.(*client.GenericError); err == nil || (isGenericError && genericError.Code == http.StatusNotFound) {
+				logrus.WithFields(logrus.Fields{
+					string(resource.Type): resource.Name,
+					"stack":               stack.Name,
+				}).Info(fmt.Sprintf("Stack %s removed", resource.Type))
+				continue
+			}
+			// The resource may still be in use by a task being torn down
+			logrus.WithFields(logrus.Fields{
+				string(resource.Type): resource.Name,
+				"stack":               stack.Name,
+				"message":             err.Error(),
+			}).Debug(fmt.Sprintf("Stack %s could not be removed yet", resource.Type))
+			stillPendingResources = append(stillPendingResources, resource)
+			lastErr = err
+		}
+		pendingResources = stillPendingResources
+
+		if len(pendingResources) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			var pendingResourceNames []string
+			for _, resource := range pendingResources {
+				pendingResourceNames = append(pendingResourceNames, fmt.Sprintf("%s/%s", resource.Type, resource.Name))
+			}
+			return fmt.Errorf("could not remove %s: %s", strings.Join(pendingResourceNames, ", "), lastErr)
+		}
+		time.Sleep(2 * time.Second)
+	}
 }
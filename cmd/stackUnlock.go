@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/greenled/portainer-stack-utils/common"
+	portainer "github.com/portainer/portainer/api"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// stackUnlockCmd represents the stack unlock command
+var stackUnlockCmd = &cobra.Command{
+	Use:   "unlock <name>",
+	Short: "Remove a stack deployment lock",
+	Example: `  Remove a lock acquired with the same lock owner:
+  psu stack unlock mystack --lock-owner ci-runner-1
+
+  Remove an abandoned lock, no matter who owns it:
+  psu stack unlock mystack --force`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		stackName := args[0]
+
+		var endpoint portainer.Endpoint
+		if endpointName := viper.GetString("stack.unlock.endpoint"); endpointName == "" {
+			// Guess endpoint if not set
+			logrus.WithFields(logrus.Fields{
+				"implications": "Command will fail if there is not exactly one endpoint available",
+			}).Warning("Endpoint not set")
+			var endpointRetrievalErr error
+			endpoint, endpointRetrievalErr = common.GetDefaultEndpoint()
+			common.CheckError(endpointRetrievalErr)
+			endpointName = endpoint.Name
+			logrus.WithFields(logrus.Fields{
+				"endpoint": endpointName,
+			}).Debug("Using the only available endpoint")
+		} else {
+			// Get endpoint by name
+			var endpointRetrievalErr error
+			endpoint, endpointRetrievalErr = common.GetEndpointByName(endpointName)
+			common.CheckError(endpointRetrievalErr)
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"endpoint": endpoint.Name,
+		}).Debug("Getting endpoint's Docker info")
+		endpointSwarmClusterID, selectionErr := common.GetEndpointSwarmClusterID(endpoint.ID)
+		if selectionErr == nil {
+			// It's a swarm cluster
+		} else if selectionErr == common.ErrStackClusterNotFound {
+			// It's not a swarm cluster
+		} else {
+			// Something else happened
+			common.CheckError(selectionErr)
+		}
+
+		lockOwner := viper.GetString("stack.unlock.lock-owner")
+		if lockOwner == "" {
+			lockOwner = common.GetDefaultStackLockOwner()
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"stack":    stackName,
+			"endpoint": endpoint.Name,
+		}).Info("Removing stack lock")
+		err := common.UnlockStack(endpoint.ID, endpointSwarmClusterID != "", stackName, lockOwner, viper.GetBool("stack.unlock.force"))
+		if err == common.ErrStackLockNotFound {
+			logrus.WithFields(logrus.Fields{
+				"stack":    stackName,
+				"endpoint": endpoint.Name,
+			}).Info("Stack is not locked")
+			return
+		} else if err == common.ErrStackLockNotOwned {
+			logrus.WithFields(logrus.Fields{
+				"stack":       stackName,
+				"endpoint":    endpoint.Name,
+				"suggestions": fmt.Sprintf("remove it anyway: psu stack unlock %s --endpoint %s --force", stackName, endpoint.Name),
+			}).Fatal("stack lock is owned by someone else")
+		}
+		common.CheckError(err)
+
+		logrus.WithFields(logrus.Fields{
+			"stack":    stackName,
+			"endpoint": endpoint.Name,
+		}).Info("Stack lock removed")
+	},
+}
+
+func init() {
+	stackCmd.AddCommand(stackUnlockCmd)
+
+	stackUnlockCmd.Flags().String("endpoint", "", "Endpoint name.")
+	stackUnlockCmd.Flags().Bool("force", false, "Remove the lock even if it is owned by someone else.")
+	stackUnlockCmd.Flags().String("lock-owner", "", "Stack lock owner. Defaults to \"USER@HOSTNAME\".")
+	viper.BindPFlag("stack.unlock.endpoint", stackUnlockCmd.Flags().Lookup("endpoint"))
+	viper.BindPFlag("stack.unlock.force", stackUnlockCmd.Flags().Lookup("force"))
+	viper.BindPFlag("stack.unlock.lock-owner", stackUnlockCmd.Flags().Lookup("lock-owner"))
+}
@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/greenled/portainer-stack-utils/client"
+	"github.com/greenled/portainer-stack-utils/common"
+	portainer "github.com/portainer/portainer/api"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// templateDeployCmd represents the template deploy command
+var templateDeployCmd = &cobra.Command{
+	Use:   "deploy <title>",
+	Short: "Deploy a stack from an app template",
+	Long: `Deploy a stack from a Swarm or Compose stack app template.
+
+The template environment variables are set with the --env flag. Variables
+which are not set take their default value, and variables without a default
+value are required. Preset variables can not be changed.`,
+	Example: `  Deploy a stack from an app template:
+  psu template deploy Wordpress --endpoint primary --env MYSQL_DATABASE_PASSWORD=s3cr3t
+
+  Deploy a stack from an app template with a custom stack name:
+  psu template deploy Wordpress --name blog --endpoint primary --env MYSQL_DATABASE_PASSWORD=s3cr3t`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		templateTitle := args[0]
+
+		portainerClient, err := common.GetClient()
+		common.CheckError(err)
+
+		logrus.WithFields(logrus.Fields{
+			"template": templateTitle,
+		}).Debug("Getting app template")
+		template, templateRetrievalErr := common.GetTemplateByTitle(templateTitle)
+		if templateRetrievalErr == common.ErrTemplateNotFound {
+			logrus.WithFields(logrus.Fields{
+				"template":    templateTitle,
+				"suggestions": "list the available app templates: psu template ls",
+			}).Fatal("App template not found")
+		}
+		common.CheckError(templateRetrievalErr)
+		if template.Type != portainer.SwarmStackTemplate && template.Type != portainer.ComposeStackTemplate {
+			logrus.WithFields(logrus.Fields{
+				"template": template.Title,
+				"type":     client.GetTranslatedTemplateType(template.Type),
+			}).Fatal("Only Swarm and Compose stack app templates can be deployed")
+		}
+
+		values, parsingErr := parseTemplateEnvironmentVariables(getTemplateDeployEnv(cmd))
+		common.CheckError(parsingErr)
+		environmentVariables, validationErr := common.GetTemplateEnvironmentVariables(template, values)
+		common.CheckError(validationErr)
+
+		stackName := viper.GetString("template.deploy.name")
+		if stackName == "" {
+			stackName = getTemplateStackName(template)
+			logrus.WithFields(logrus.Fields{
+				"stack": stackName,
+			}).Debug("Using a stack name based on the app template title")
+		}
+
+		var endpoint portainer.Endpoint
+		if endpointName := viper.GetString("template.deploy.endpoint"); endpointName == "" {
+			// Guess endpoint if not set
+			logrus.WithFields(logrus.Fields{
+				"implications": "Command will fail if there is not exactly one endpoint available",
+			}).Warning("Endpoint not set")
+			var endpointRetrievalErr error
+			endpoint, endpointRetrievalErr = common.GetDefaultEndpoint()
+			common.CheckError(endpointRetrievalErr)
+			endpointName = endpoint.Name
+			logrus.WithFields(logrus.Fields{
+				"endpoint": endpointName,
+			}).Debug("Using the only available endpoint")
+		} else {
+			// Get endpoint by name
+			var endpointRetrievalErr error
+			endpoint, endpointRetrievalErr = common.GetEndpointByName(endpointName)
+			common.CheckError(endpointRetrievalErr)
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"endpoint": endpoint.Name,
+		}).Debug("Getting endpoint's Docker info")
+		endpointSwarmClusterID, selectionErr := common.GetEndpointSwarmClusterID(endpoint.ID)
+		if selectionErr == common.ErrStackClusterNotFound {
+			// It's not a swarm cluster
+			if template.Type == portainer.SwarmStackTemplate {
+				logrus.WithFields(logrus.Fields{
+					"template": template.Title,
+					"endpoint": endpoint.Name,
+				}).Fatal("Swarm stack app templates can only be deployed in Swarm endpoints")
+			}
+		} else {
+			common.CheckError(selectionErr)
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"stack":    stackName,
+			"endpoint": endpoint.Name,
+		}).Debug("Getting stack")
+		_, stackRetrievalErr := common.GetStackByName(stackName, endpointSwarmClusterID, endpoint.ID)
+		if stackRetrievalErr == nil {
+			logrus.WithFields(logrus.Fields{
+				"stack":       stackName,
+				"endpoint":    endpoint.Name,
+				"suggestions": "set a different stack name with the --name flag",
+			}).Fatal("Stack already exists")
+		} else if stackRetrievalErr != common.ErrStackNotFound {
+			common.CheckError(stackRetrievalErr)
+		}
+
+		repository := &client.StackCreateRepository{
+			URL:           template.Repository.URL,
+			StackFilePath: template.Repository.StackFile,
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"stack":    stackName,
+			"endpoint": endpoint.Name,
+			"template": template.Title,
+		}).Info("Creating stack from app template")
+		var deploymentErr error
+		startedAt := time.Now()
+		if template.Type == portainer.SwarmStackTemplate {
+			_, deploymentErr = portainerClient.StackCreateSwarm(client.StackCreateSwarmOptions{
+				StackName:            stackName,
+				EnvironmentVariables: environmentVariables,
+				Repository:           repository,
+				SwarmClusterID:       endpointSwarmClusterID,
+				EndpointID:           endpoint.ID,
+			})
+		} else {
+			_, deploymentErr = portainerClient.StackCreateCompose(client.StackCreateComposeOptions{
+				StackName:            stackName,
+				EnvironmentVariables: environmentVariables,
+				Repository:           repository,
+				EndpointID:           endpoint.ID,
+			})
+		}
+		common.Notify(common.NewNotification(common.NotificationActionDeploy, stackName, endpoint.Name, startedAt, deploymentErr))
+		common.CheckError(deploymentErr)
+		logrus.WithFields(logrus.Fields{
+			"stack":    stackName,
+			"endpoint": endpoint.Name,
+		}).Info("Stack created")
+	},
+}
+
+func init() {
+	templateCmd.AddCommand(templateDeployCmd)
+
+	templateDeployCmd.Flags().String("endpoint", "", "Endpoint name.")
+	templateDeployCmd.Flags().String("name", "", "Stack name. Defaults to the app template title in lowercase, with spaces replaced by dashes.")
+	templateDeployCmd.Flags().StringArray("env", []string{}, "Environment variable for the app template, in KEY=VALUE format. Can be used several times.")
+	viper.BindPFlag("template.deploy.endpoint", templateDeployCmd.Flags().Lookup("endpoint"))
+	viper.BindPFlag("template.deploy.name", templateDeployCmd.Flags().Lookup("name"))
+}
+
+// getTemplateDeployEnv returns the environment variables set for an app
+// template deployment. The env flag is not bound to viper, as it does not
+// support string array flags (values may contain commas).
+func getTemplateDeployEnv(cmd *cobra.Command) (env []string) {
+	env, _ = cmd.Flags().GetStringArray("env")
+	if len(env) == 0 {
+		env = viper.GetStringSlice("template.deploy.env")
+	}
+	return
+}
+
+// parseTemplateEnvironmentVariables parses environment variables in KEY=VALUE format
+func parseTemplateEnvironmentVariables(env []string) (values map[string]string, err error) {
+	values = map[string]string{}
+	for _, entry := range env {
+		entryParts := strings.SplitN(entry, "=", 2)
+		if len(entryParts) != 2 || entryParts[0] == "" {
+			err = fmt.Errorf("invalid environment variable %q: it must be in KEY=VALUE format", entry)
+			return
+		}
+		values[entryParts[0]] = entryParts[1]
+	}
+	return
+}
+
+// getTemplateStackName returns a stack name based on an app template title,
+// like "my-app" for "My App"
+func getTemplateStackName(template portainer.Template) string {
+	name := regexp.MustCompile(`[^a-z0-9_-]+`).ReplaceAllString(strings.ToLower(template.Title), "-")
+	return strings.Trim(name, "-_")
+}
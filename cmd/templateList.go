@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/greenled/portainer-stack-utils/client"
+	"github.com/greenled/portainer-stack-utils/common"
+	portainer "github.com/portainer/portainer/api"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// templateListCmd represents the template list command
+var templateListCmd = &cobra.Command{
+	Use:     "list",
+	Short:   "List app templates",
+	Aliases: []string{"ls"},
+	Example: `  Print app templates in a table format:
+  psu template ls
+
+  Print titles of app templates:
+  psu template ls --format "{{ .Title }}"
+
+  Print environment variables of app templates:
+  psu template ls --format "{{ .Title }}: {{ range .Env }}{{ .Name }}=\"{{ .Default }}\" {{ end }}"`,
+	Run: func(cmd *cobra.Command, args []string) {
+		portainerClient, err := common.GetClient()
+		common.CheckError(err)
+
+		logrus.Debug("Getting app templates")
+		templates, err := portainerClient.TemplateList()
+		common.CheckError(err)
+
+		switch viper.GetString("template.list.format") {
+		case "table":
+			// Print templates in a table format
+			writer, err := common.NewTabWriter([]string{
+				"ID",
+				"TITLE",
+				"TYPE",
+				"CATEGORIES",
+			})
+			common.CheckError(err)
+			for _, t := range templates {
+				_, err = fmt.Fprintln(writer, fmt.Sprintf(
+					"%v\t%s\t%s\t%s",
+					t.ID,
+					t.Title,
+					client.GetTranslatedTemplateType(t.Type),
+					strings.Join(t.Categories, ","),
+				))
+				common.CheckError(err)
+			}
+			flushErr := writer.Flush()
+			common.CheckError(flushErr)
+		case "json":
+			// Print templates in a json format
+			templatesJSONBytes, err := json.Marshal(templates)
+			common.CheckError(err)
+			fmt.Println(string(templatesJSONBytes))
+		default:
+			// Print templates in a custom format
+			template, templateParsingErr := template.New("templateTpl").Parse(viper.GetString("template.list.format"))
+			common.CheckError(templateParsingErr)
+			for _, t := range templates {
+				templateExecutionErr := template.Execute(os.Stdout, t)
+				common.CheckError(templateExecutionErr)
+				fmt.Println()
+			}
+		}
+	},
+}
+
+func init() {
+	templateCmd.AddCommand(templateListCmd)
+
+	templateListCmd.Flags().String("format", "table", `Output format. Can be "table", "json" or a Go template.`)
+	viper.BindPFlag("template.list.format", templateListCmd.Flags().Lookup("format"))
+
+	templateListCmd.SetUsageTemplate(templateListCmd.UsageTemplate() + common.GetFormatHelp(portainer.Template{}))
+}
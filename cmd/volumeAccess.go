@@ -15,8 +15,20 @@ func init() {
 	volumeAccessCmd.Flags().Bool("admins", false, "Permit access to this volume to administrators only.")
 	volumeAccessCmd.Flags().Bool("private", false, "Permit access to this volume to the current user only.")
 	volumeAccessCmd.Flags().Bool("public", false, "Permit access to this volume to any user.")
+	volumeAccessCmd.Flags().StringSlice("users", []string{}, "Permit access to this volume to users, by name. Can be used several times, and along with --private.")
+	volumeAccessCmd.Flags().StringSlice("teams", []string{}, "Permit access to this volume to teams, by name. Can be used several times, and along with --private.")
+	volumeAccessCmd.Flags().StringSlice("add-user", []string{}, "Add users to the ones with access to this volume, by name. Can be used several times.")
+	volumeAccessCmd.Flags().StringSlice("remove-user", []string{}, "Remove users from the ones with access to this volume, by name. Can be used several times.")
+	volumeAccessCmd.Flags().StringSlice("add-team", []string{}, "Add teams to the ones with access to this volume, by name. Can be used several times.")
+	volumeAccessCmd.Flags().StringSlice("remove-team", []string{}, "Remove teams from the ones with access to this volume, by name. Can be used several times.")
 	viper.BindPFlag("volume.access.endpoint", volumeAccessCmd.Flags().Lookup("endpoint"))
 	viper.BindPFlag("volume.access.admins", volumeAccessCmd.Flags().Lookup("admins"))
 	viper.BindPFlag("volume.access.private", volumeAccessCmd.Flags().Lookup("private"))
 	viper.BindPFlag("volume.access.public", volumeAccessCmd.Flags().Lookup("public"))
+	viper.BindPFlag("volume.access.users", volumeAccessCmd.Flags().Lookup("users"))
+	viper.BindPFlag("volume.access.teams", volumeAccessCmd.Flags().Lookup("teams"))
+	viper.BindPFlag("volume.access.add-user", volumeAccessCmd.Flags().Lookup("add-user"))
+	viper.BindPFlag("volume.access.remove-user", volumeAccessCmd.Flags().Lookup("remove-user"))
+	viper.BindPFlag("volume.access.add-team", volumeAccessCmd.Flags().Lookup("add-team"))
+	viper.BindPFlag("volume.access.remove-team", volumeAccessCmd.Flags().Lookup("remove-team"))
 }
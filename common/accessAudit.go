@@ -0,0 +1,179 @@
+package common
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/greenled/portainer-stack-utils/client"
+	portainer "github.com/portainer/portainer/api"
+)
+
+// Access audit findings
+const (
+	// AccessFindingPublic means any user has access to a resource
+	AccessFindingPublic = "public"
+	// AccessFindingAdminsOnly means only administrators have access to a resource
+	AccessFindingAdminsOnly = "admins-only"
+	// AccessFindingDeletedUsers means a resource's access control references users that no longer exist
+	AccessFindingDeletedUsers = "deleted-users"
+	// AccessFindingDeletedTeams means a resource's access control references teams that no longer exist
+	AccessFindingDeletedTeams = "deleted-teams"
+)
+
+// AccessControlledResourceTypes are the types of resources which can have an access control
+var AccessControlledResourceTypes = []client.ResourceType{
+	client.ResourceStack,
+	client.ResourceService,
+	client.ResourceContainer,
+	client.ResourceVolume,
+	client.ResourceNetwork,
+	client.ResourceSecret,
+	client.ResourceConfig,
+}
+
+// AccessAuditEntry represents the access control audit result for a resource
+type AccessAuditEntry struct {
+	// Endpoint is the name of the endpoint the resource lives in
+	Endpoint string
+	// Type is the resource type
+	Type client.ResourceType
+	// ID is the resource id (or name for stacks and volumes)
+	ID string
+	// Name is the resource name
+	Name string
+	// Access is one of admins, public or restricted
+	Access string
+	// Findings are the access control issues found
+	Findings []string
+	// DeletedUsers are the ids of the users with access to the resource that no longer exist
+	DeletedUsers []portainer.UserID
+	// DeletedTeams are the ids of the teams with access to the resource that no longer exist
+	DeletedTeams []portainer.TeamID
+}
+
+// NewAccessAuditEntry audits a resource's access control (if found) against
+// the existing users and teams
+func NewAccessAuditEntry(resource DockerResource, found bool, users []portainer.User, teams []portainer.Team) (entry AccessAuditEntry) {
+	entry = AccessAuditEntry{
+		ID:     resource.ID,
+		Name:   resource.Name,
+		Type:   resource.Type,
+		Access: GetAccessInfoType(resource.ResourceControl, found),
+	}
+
+	switch entry.Access {
+	case AccessInfoAdmins:
+		entry.Findings = append(entry.Findings, AccessFindingAdminsOnly)
+		return
+	case AccessInfoPublic:
+		entry.Findings = append(entry.Findings, AccessFindingPublic)
+	}
+
+	for _, userAccess := range resource.ResourceControl.UserAccesses {
+		userExists := false
+		for _, user := range users {
+			if user.ID == userAccess.UserID {
+				userExists = true
+				break
+			}
+		}
+		if !userExists {
+			entry.DeletedUsers = append(entry.DeletedUsers, userAccess.UserID)
+		}
+	}
+	if len(entry.DeletedUsers) > 0 {
+		entry.Findings = append(entry.Findings, AccessFindingDeletedUsers)
+	}
+
+	for _, teamAccess := range resource.ResourceControl.TeamAccesses {
+		teamExists := false
+		for _, team := range teams {
+			if team.ID == teamAccess.TeamID {
+				teamExists = true
+				break
+			}
+		}
+		if !teamExists {
+			entry.DeletedTeams = append(entry.DeletedTeams, teamAccess.TeamID)
+		}
+	}
+	if len(entry.DeletedTeams) > 0 {
+		entry.Findings = append(entry.Findings, AccessFindingDeletedTeams)
+	}
+
+	return
+}
+
+// GetStackResources retrieves the stacks in an endpoint as resources
+// decorated with their Portainer access control
+func GetStackResources(endpointID portainer.EndpointID) (resources []DockerResource, err error) {
+	portainerClient, err := GetClient()
+	if err != nil {
+		return
+	}
+
+	var stacks []decoratedStack
+	err = portainerClient.DoJSONWithToken(fmt.Sprintf("stacks?filters={\"EndpointId\":%d}", endpointID), http.MethodGet, http.Header{}, nil, &stacks)
+	if err != nil {
+		return
+	}
+
+	for _, stack := range stacks {
+		resources = append(resources, DockerResource{
+			ID:              stack.Name,
+			Name:            stack.Name,
+			Type:            client.ResourceStack,
+			ResourceControl: stack.ResourceControl,
+		})
+	}
+
+	return
+}
+
+// GetEndpointResources retrieves every stack and Docker resource in an
+// endpoint, decorated with their Portainer access control. Swarm-only
+// resources (services, secrets and configs) are skipped in non-swarm endpoints.
+func GetEndpointResources(endpoint portainer.Endpoint) (resources []DockerResource, err error) {
+	_, err = GetEndpointSwarmClusterID(endpoint.ID)
+	isSwarm := err == nil
+	if err != nil && err != ErrStackClusterNotFound {
+		return
+	}
+	err = nil
+
+	for _, resourceType := range AccessControlledResourceTypes {
+		if !isSwarm && (resourceType == client.ResourceService || resourceType == client.ResourceSecret || resourceType == client.ResourceConfig) {
+			continue
+		}
+
+		var typeResources []DockerResource
+		if resourceType == client.ResourceStack {
+			typeResources, err = GetStackResources(endpoint.ID)
+		} else {
+			typeResources, err = GetDockerResources(endpoint.ID, resourceType)
+		}
+		if err != nil {
+			return
+		}
+		resources = append(resources, typeResources...)
+	}
+
+	return
+}
+
+// AuditEndpointAccessControl audits the access control of every stack and
+// Docker resource in an endpoint
+func AuditEndpointAccessControl(endpoint portainer.Endpoint, users []portainer.User, teams []portainer.Team) (entries []AccessAuditEntry, err error) {
+	resources, err := GetEndpointResources(endpoint)
+	if err != nil {
+		return
+	}
+
+	for _, resource := range resources {
+		entry := NewAccessAuditEntry(resource, resource.HasAccessControl(), users, teams)
+		entry.Endpoint = endpoint.Name
+		entries = append(entries, entry)
+	}
+
+	return
+}
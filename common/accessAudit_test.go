@@ -0,0 +1,93 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/greenled/portainer-stack-utils/client"
+	portainer "github.com/portainer/portainer/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewAccessAuditEntry(t *testing.T) {
+	users := []portainer.User{{ID: 1}, {ID: 2}}
+	teams := []portainer.Team{{ID: 1}}
+	type args struct {
+		resource DockerResource
+		found    bool
+	}
+	tests := []struct {
+		name string
+		args args
+		want AccessAuditEntry
+	}{
+		{
+			name: "resources without access control are reported as admins only",
+			args: args{
+				resource: DockerResource{ID: "abc", Name: "web_app", Type: client.ResourceService},
+			},
+			want: AccessAuditEntry{
+				ID:       "abc",
+				Name:     "web_app",
+				Type:     client.ResourceService,
+				Access:   AccessInfoAdmins,
+				Findings: []string{AccessFindingAdminsOnly},
+			},
+		},
+		{
+			name: "public resources are reported",
+			args: args{
+				resource: DockerResource{ID: "web", Name: "web", Type: client.ResourceStack, ResourceControl: portainer.ResourceControl{ID: 1, Public: true}},
+				found:    true,
+			},
+			want: AccessAuditEntry{
+				ID:       "web",
+				Name:     "web",
+				Type:     client.ResourceStack,
+				Access:   AccessInfoPublic,
+				Findings: []string{AccessFindingPublic},
+			},
+		},
+		{
+			name: "restricted resources with existing users and teams have no findings",
+			args: args{
+				resource: DockerResource{ID: "data", Name: "data", Type: client.ResourceVolume, ResourceControl: portainer.ResourceControl{
+					ID:           1,
+					UserAccesses: []portainer.UserResourceAccess{{UserID: 1}, {UserID: 2}},
+					TeamAccesses: []portainer.TeamResourceAccess{{TeamID: 1}},
+				}},
+				found: true,
+			},
+			want: AccessAuditEntry{
+				ID:     "data",
+				Name:   "data",
+				Type:   client.ResourceVolume,
+				Access: AccessInfoRestricted,
+			},
+		},
+		{
+			name: "deleted users and teams are reported",
+			args: args{
+				resource: DockerResource{ID: "data", Name: "data", Type: client.ResourceVolume, ResourceControl: portainer.ResourceControl{
+					ID:           1,
+					UserAccesses: []portainer.UserResourceAccess{{UserID: 1}, {UserID: 3}, {UserID: 4}},
+					TeamAccesses: []portainer.TeamResourceAccess{{TeamID: 2}},
+				}},
+				found: true,
+			},
+			want: AccessAuditEntry{
+				ID:           "data",
+				Name:         "data",
+				Type:         client.ResourceVolume,
+				Access:       AccessInfoRestricted,
+				Findings:     []string{AccessFindingDeletedUsers, AccessFindingDeletedTeams},
+				DeletedUsers: []portainer.UserID{3, 4},
+				DeletedTeams: []portainer.TeamID{2},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, NewAccessAuditEntry(tt.args.resource, tt.args.found, users, teams))
+		})
+	}
+}
@@ -2,7 +2,7 @@ package common
 
 import (
 	"fmt"
-	"net/http"
+	"strings"
 
 	"github.com/greenled/portainer-stack-utils/client"
 	portainer "github.com/portainer/portainer/api"
@@ -18,18 +18,7 @@ func NewAccessCmd(resourceType client.ResourceType, argumentName string) *cobra.
 		Short: fmt.Sprintf("Set access control for %s", resourceType),
 		Args:  cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			portainerClient, clientRetrievalErr := GetClient()
-			CheckError(clientRetrievalErr)
-
-			resourceID := args[0]
-
-			setAdmins := viper.GetBool(fmt.Sprintf("%s.access.admins", resourceType))
-			setPrivate := viper.GetBool(fmt.Sprintf("%s.access.private", resourceType))
-			setPublic := viper.GetBool(fmt.Sprintf("%s.access.public", resourceType))
-
-			if (setAdmins && setPrivate) || (setPrivate && setPublic) || (setPublic && setAdmins) {
-				logrus.Fatal("only one of --admins, --private or --public flags can be used")
-			}
+			var resourceID string
 
 			var endpoint portainer.Endpoint
 			if endpointName := viper.GetString(fmt.Sprintf("%s.access.endpoint", resourceType)); endpointName == "" {
@@ -51,63 +40,23 @@ func NewAccessCmd(resourceType client.ResourceType, argumentName string) *cobra.
 				CheckError(endpointRetrievalErr)
 			}
 
+			logrus.WithFields(logrus.Fields{
+				string(resourceType): args[0],
+				"endpoint":           endpoint.Name,
+			}).Debug(fmt.Sprintf("Getting %s", resourceType))
+			resource, resourceRetrievalErr := ResolveDockerResource(endpoint.ID, resourceType, args[0])
+			CheckError(resourceRetrievalErr)
+			resourceID = resource.ID
+
 			logrus.WithFields(logrus.Fields{
 				"endpoint": endpoint.Name,
 			}).Debug(fmt.Sprintf("Getting %s access control info", resourceType))
 
-			if setAdmins {
-				// We are removing an access control
-				resourceControl, err := GetDockerResourcePortainerAccessControl(endpoint.ID, resourceID, resourceType)
-				if err == nil {
-					err = portainerClient.ResourceControlDelete(resourceControl.ID)
-				} else if err != ErrAccessControlNotFound {
-					CheckError(err)
-				}
-			} else {
-				// We may be creating a new access control
-				resourceControlCreateOptions := client.ResourceControlCreateOptions{
-					ResourceID: resourceID,
-					Type:       resourceType,
-				}
-				if setPrivate {
-					currentUser, err := GetUserByName(portainerClient.GetUsername())
-					CheckError(err)
-					resourceControlCreateOptions.Users = []portainer.UserID{currentUser.ID}
-				}
-				if setPublic {
-					resourceControlCreateOptions.Public = true
-				}
-				_, err := portainerClient.ResourceControlCreate(resourceControlCreateOptions)
-
-				if err != nil {
-					genericError, isGenericError := err.(*client.GenericError)
-					if isGenericError && genericError.Code == http.StatusConflict {
-						// We are updating an existing access control
-						resourceControl, err := GetDockerResourcePortainerAccessControl(endpoint.ID, resourceID, resourceType)
-						if err == nil {
-							resourceControlUpdateOptions := client.ResourceControlUpdateOptions{
-								ID: resourceControl.ID,
-							}
-							if setPrivate {
-								currentUser, err := GetUserByName(portainerClient.GetUsername())
-								CheckError(err)
-								resourceControlUpdateOptions.Users = []portainer.UserID{currentUser.ID}
-							}
-							if setPublic {
-								resourceControlUpdateOptions.Public = true
-							}
-							_, err := portainerClient.ResourceControlUpdate(resourceControlUpdateOptions)
-							CheckError(err)
-						} else {
-							// Something else happened
-							CheckError(err)
-						}
-					} else {
-						// Something else happened
-						CheckError(err)
-					}
-				}
-			}
+			accessControl, accessControlErr := GetAccessCmdAccessControl(fmt.Sprintf("%s.access", resourceType), endpoint.ID, resourceID, resourceType)
+			CheckError(accessControlErr)
+
+			err := SetPortainerAccessControl(endpoint.ID, resourceID, resourceType, accessControl)
+			CheckError(err)
 
 			logrus.WithFields(logrus.Fields{
 				string(resourceType): resourceID,
@@ -118,15 +67,360 @@ func NewAccessCmd(resourceType client.ResourceType, argumentName string) *cobra.
 
 // AccessCmdInitFunc creates an access command for a given Docker resource type
 func AccessCmdInitFunc(parentCmd *cobra.Command, resourceControlType client.ResourceType) {
-	accessCmd := NewAccessCmd(resourceControlType, fmt.Sprintf("|%sId", resourceControlType))
+	argumentName := fmt.Sprintf("%sName|%sId", resourceControlType, resourceControlType)
+	accessCmd := NewAccessCmd(resourceControlType, argumentName)
 	parentCmd.AddCommand(accessCmd)
 
 	accessCmd.Flags().String("endpoint", "", "Endpoint name.")
 	accessCmd.Flags().Bool("admins", false, fmt.Sprintf("Permit access to this %s to administrators only.", resourceControlType))
 	accessCmd.Flags().Bool("private", false, fmt.Sprintf("Permit access to this %s to the current user only.", resourceControlType))
 	accessCmd.Flags().Bool("public", false, fmt.Sprintf("Permit access to this %s to any user.", resourceControlType))
+	accessCmd.Flags().StringSlice("users", []string{}, fmt.Sprintf("Permit access to this %s to users, by name. Can be used several times, and along with --private.", resourceControlType))
+	accessCmd.Flags().StringSlice("teams", []string{}, fmt.Sprintf("Permit access to this %s to teams, by name. Can be used several times, and along with --private.", resourceControlType))
+	accessCmd.Flags().StringSlice("add-user", []string{}, fmt.Sprintf("Add users to the ones with access to this %s, by name. Can be used several times.", resourceControlType))
+	accessCmd.Flags().StringSlice("remove-user", []string{}, fmt.Sprintf("Remove users from the ones with access to this %s, by name. Can be used several times.", resourceControlType))
+	accessCmd.Flags().StringSlice("add-team", []string{}, fmt.Sprintf("Add teams to the ones with access to this %s, by name. Can be used several times.", resourceControlType))
+	accessCmd.Flags().StringSlice("remove-team", []string{}, fmt.Sprintf("Remove teams from the ones with access to this %s, by name. Can be used several times.", resourceControlType))
 	viper.BindPFlag(fmt.Sprintf("%s.access.endpoint", resourceControlType), accessCmd.Flags().Lookup("endpoint"))
 	viper.BindPFlag(fmt.Sprintf("%s.access.admins", resourceControlType), accessCmd.Flags().Lookup("admins"))
 	viper.BindPFlag(fmt.Sprintf("%s.access.private", resourceControlType), accessCmd.Flags().Lookup("private"))
 	viper.BindPFlag(fmt.Sprintf("%s.access.public", resourceControlType), accessCmd.Flags().Lookup("public"))
+	viper.BindPFlag(fmt.Sprintf("%s.access.users", resourceControlType), accessCmd.Flags().Lookup("users"))
+	viper.BindPFlag(fmt.Sprintf("%s.access.teams", resourceControlType), accessCmd.Flags().Lookup("teams"))
+	viper.BindPFlag(fmt.Sprintf("%s.access.add-user", resourceControlType), accessCmd.Flags().Lookup("add-user"))
+	viper.BindPFlag(fmt.Sprintf("%s.access.remove-user", resourceControlType), accessCmd.Flags().Lookup("remove-user"))
+	viper.BindPFlag(fmt.Sprintf("%s.access.add-team", resourceControlType), accessCmd.Flags().Lookup("add-team"))
+	viper.BindPFlag(fmt.Sprintf("%s.access.remove-team", resourceControlType), accessCmd.Flags().Lookup("remove-team"))
+}
+
+// GetAccessCmdAccessControl returns the access control set by an access
+// command flags on a resource, whose values are read from the configuration
+// keys with a given prefix (like "stack.access"). The access control is
+// either fully set (admins, private, public, users and teams flags) or
+// incrementally changed from the resource's current one (add-user,
+// remove-user, add-team and remove-team flags).
+func GetAccessCmdAccessControl(keyPrefix string, endpointID portainer.EndpointID, resourceID string, resourceType client.ResourceType) (accessControl AccessControl, err error) {
+	var modes []string
+	for _, mode := range AccessModes {
+		if viper.GetBool(fmt.Sprintf("%s.%s", keyPrefix, mode)) {
+			modes = append(modes, mode)
+		}
+	}
+	if len(modes) > 1 {
+		err = fmt.Errorf("only one of --admins, --private or --public flags can be used")
+		return
+	}
+	var mode string
+	if len(modes) == 1 {
+		mode = modes[0]
+	}
+
+	userNames := viper.GetStringSlice(fmt.Sprintf("%s.users", keyPrefix))
+	teamNames := viper.GetStringSlice(fmt.Sprintf("%s.teams", keyPrefix))
+
+	changes, changed, err := GetAccessControlChanges(keyPrefix)
+	if err != nil {
+		return
+	}
+	if changed {
+		// We are changing the current access control
+		if mode != "" || len(userNames) > 0 || len(teamNames) > 0 {
+			err = fmt.Errorf("--add-user, --remove-user, --add-team and --remove-team flags can not be used along with --admins, --private, --public, --users or --teams flags")
+			return
+		}
+
+		logrus.WithFields(logrus.Fields{
+			string(resourceType): resourceID,
+		}).Debug("Getting current access control")
+		resourceControl, accessControlRetrievalErr := GetPortainerAccessControl(endpointID, resourceID, resourceType)
+		if accessControlRetrievalErr != nil && accessControlRetrievalErr != ErrAccessControlNotFound {
+			err = accessControlRetrievalErr
+			return
+		}
+		accessControl = changes.Apply(resourceControl, accessControlRetrievalErr == nil)
+		return
+	}
+
+	if mode == "" && len(userNames) == 0 && len(teamNames) == 0 {
+		err = fmt.Errorf("one of --admins, --private, --public, --users, --teams, --add-user, --remove-user, --add-team or --remove-team flags must be used")
+		return
+	}
+	if (mode == AccessModeAdmins || mode == AccessModePublic) && (len(userNames) > 0 || len(teamNames) > 0) {
+		err = fmt.Errorf("--users and --teams flags can not be used along with --%s flag", mode)
+		return
+	}
+
+	return GetAccessControl(mode, userNames, teamNames)
+}
+
+// GetAccessControlChanges returns the incremental access control changes
+// set by the add-user, remove-user, add-team and remove-team configuration
+// keys with a given prefix (like "stack.access"), resolving users and teams
+// by name, and whether there is any change
+func GetAccessControlChanges(keyPrefix string) (changes AccessControlChanges, changed bool, err error) {
+	addUserNames := viper.GetStringSlice(fmt.Sprintf("%s.add-user", keyPrefix))
+	removeUserNames := viper.GetStringSlice(fmt.Sprintf("%s.remove-user", keyPrefix))
+	addTeamNames := viper.GetStringSlice(fmt.Sprintf("%s.add-team", keyPrefix))
+	removeTeamNames := viper.GetStringSlice(fmt.Sprintf("%s.remove-team", keyPrefix))
+	changed = len(addUserNames) > 0 || len(removeUserNames) > 0 || len(addTeamNames) > 0 || len(removeTeamNames) > 0
+
+	if changes.AddUsers, err = getUserIDs(addUserNames); err != nil {
+		return
+	}
+	if changes.RemoveUsers, err = getUserIDs(removeUserNames); err != nil {
+		return
+	}
+	if changes.AddTeams, err = getTeamIDs(addTeamNames); err != nil {
+		return
+	}
+	changes.RemoveTeams, err = getTeamIDs(removeTeamNames)
+	return
+}
+
+// Access control modes
+const (
+	// AccessModeAdmins gives access to administrators only
+	AccessModeAdmins = "admins"
+	// AccessModePrivate gives access to the current user (and administrators)
+	AccessModePrivate = "private"
+	// AccessModePublic gives access to any user
+	AccessModePublic = "public"
+)
+
+// AccessModes lists the available access control modes
+var AccessModes = []string{
+	AccessModeAdmins,
+	AccessModePrivate,
+	AccessModePublic,
+}
+
+// GetAccessControl returns the access control for an access mode, granting
+// access to some users and teams by name. Access is restricted to the given
+// users and teams when no mode is set, and the current user is added to them
+// in private mode. Users and teams can not be used with other modes.
+func GetAccessControl(mode string, userNames, teamNames []string) (accessControl AccessControl, err error) {
+	switch mode {
+	case AccessModeAdmins, AccessModePublic:
+		if len(userNames) > 0 || len(teamNames) > 0 {
+			err = fmt.Errorf("users and teams can not be given access along with %s access", mode)
+			return
+		}
+		accessControl.AdministratorsOnly = mode == AccessModeAdmins
+		accessControl.Public = mode == AccessModePublic
+		return
+	case AccessModePrivate:
+		var portainerClient client.PortainerClient
+		portainerClient, err = GetClient()
+		if err != nil {
+			return
+		}
+		userNames = append([]string{portainerClient.GetUsername()}, userNames...)
+	case "":
+		if len(userNames) == 0 && len(teamNames) == 0 {
+			err = fmt.Errorf("no access mode, users nor teams set")
+			return
+		}
+	default:
+		err = fmt.Errorf("unknown access %q (must be one of %s)", mode, strings.Join(AccessModes, ", "))
+		return
+	}
+
+	accessControl.Users, err = getUserIDs(userNames)
+	if err != nil {
+		return
+	}
+	accessControl.Teams, err = getTeamIDs(teamNames)
+	return
+}
+
+// getUserIDs returns the ids of some users by name, without duplicates
+func getUserIDs(userNames []string) (ids []portainer.UserID, err error) {
+	for _, userName := range userNames {
+		var user portainer.User
+		user, err = GetUserByName(userName)
+		if err != nil {
+			err = fmt.Errorf("could not get user %s: %s", userName, err)
+			return
+		}
+		if !containsUserID(ids, user.ID) {
+			ids = append(ids, user.ID)
+		}
+	}
+	return
+}
+
+// getTeamIDs returns the ids of some teams by name, without duplicates
+func getTeamIDs(teamNames []string) (ids []portainer.TeamID, err error) {
+	for _, teamName := range teamNames {
+		var team portainer.Team
+		team, err = GetTeamByName(teamName)
+		if err != nil {
+			err = fmt.Errorf("could not get team %s: %s", teamName, err)
+			return
+		}
+		if !containsTeamID(ids, team.ID) {
+			ids = append(ids, team.ID)
+		}
+	}
+	return
+}
+
+// containsUserID checks if a user id is in a list of user ids
+func containsUserID(ids []portainer.UserID, id portainer.UserID) bool {
+	for _, listID := range ids {
+		if listID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// containsTeamID checks if a team id is in a list of team ids
+func containsTeamID(ids []portainer.TeamID, id portainer.TeamID) bool {
+	for _, listID := range ids {
+		if listID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// AccessControlChanges represents incremental changes to the users and teams
+// with access to a resource
+type AccessControlChanges struct {
+	AddUsers    []portainer.UserID
+	RemoveUsers []portainer.UserID
+	AddTeams    []portainer.TeamID
+	RemoveTeams []portainer.TeamID
+}
+
+// Apply returns the access control resulting of applying the changes to an
+// existing resource control (if found). Resources left without users, teams
+// nor public access get administrators only access.
+func (c AccessControlChanges) Apply(resourceControl portainer.ResourceControl, found bool) (accessControl AccessControl) {
+	if found {
+		accessControl.Public = resourceControl.Public
+		for _, userAccess := range resourceControl.UserAccesses {
+			if !containsUserID(c.RemoveUsers, userAccess.UserID) {
+				accessControl.Users = append(accessControl.Users, userAccess.UserID)
+			}
+		}
+		for _, teamAccess := range resourceControl.TeamAccesses {
+			if !containsTeamID(c.RemoveTeams, teamAccess.TeamID) {
+				accessControl.Teams = append(accessControl.Teams, teamAccess.TeamID)
+			}
+		}
+	}
+	for _, userID := range c.AddUsers {
+		if !containsUserID(accessControl.Users, userID) && !containsUserID(c.RemoveUsers, userID) {
+			accessControl.Users = append(accessControl.Users, userID)
+		}
+	}
+	for _, teamID := range c.AddTeams {
+		if !containsTeamID(accessControl.Teams, teamID) && !containsTeamID(c.RemoveTeams, teamID) {
+			accessControl.Teams = append(accessControl.Teams, teamID)
+		}
+	}
+	accessControl.AdministratorsOnly = !accessControl.Public && len(accessControl.Users) == 0 && len(accessControl.Teams) == 0
+	return
+}
+
+// NewAccessControlFromResourceControl returns the access control granted by
+// an existing resource control (if found)
+func NewAccessControlFromResourceControl(resourceControl portainer.ResourceControl, found bool) AccessControl {
+	return AccessControlChanges{}.Apply(resourceControl, found)
+}
+
+// AccessControl represents the access control to be set on a resource
+type AccessControl struct {
+	AdministratorsOnly bool
+	Public             bool
+	Users              []portainer.UserID
+	Teams              []portainer.TeamID
+}
+
+// Matches checks if an existing resource control (if found) grants the same
+// access as the access control
+func (ac AccessControl) Matches(resourceControl portainer.ResourceControl, found bool) bool {
+	if ac.AdministratorsOnly || !found {
+		return ac.AdministratorsOnly == !found
+	}
+	if ac.Public != resourceControl.Public || len(ac.Users) != len(resourceControl.UserAccesses) || len(ac.Teams) != len(resourceControl.TeamAccesses) {
+		return false
+	}
+UsersLoop:
+	for _, userID := range ac.Users {
+		for _, userAccess := range resourceControl.UserAccesses {
+			if userAccess.UserID == userID {
+				continue UsersLoop
+			}
+		}
+		return false
+	}
+TeamsLoop:
+	for _, teamID := range ac.Teams {
+		for _, teamAccess := range resourceControl.TeamAccesses {
+			if teamAccess.TeamID == teamID {
+				continue TeamsLoop
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// GetPortainerAccessControl retrieves a Docker resource's or stack's Portainer access control (if any)
+func GetPortainerAccessControl(endpointID portainer.EndpointID, resourceID string, resourceType client.ResourceType) (resourceControl portainer.ResourceControl, err error) {
+	if resourceType == client.ResourceStack {
+		return GetStackPortainerAccessControl(endpointID, resourceID)
+	}
+	return GetDockerResourcePortainerAccessControl(endpointID, resourceID, resourceType)
+}
+
+// SetPortainerAccessControl sets a Docker resource's or stack's Portainer
+// access control. Administrators only access is set by removing the existing
+// resource control (if any). Otherwise a new resource control is created, or
+// the existing one is updated if there is one already.
+func SetPortainerAccessControl(endpointID portainer.EndpointID, resourceID string, resourceType client.ResourceType, accessControl AccessControl) (err error) {
+	portainerClient, err := GetClient()
+	if err != nil {
+		return
+	}
+
+	if accessControl.AdministratorsOnly {
+		// We are removing an access control
+		var resourceControl portainer.ResourceControl
+		resourceControl, err = GetPortainerAccessControl(endpointID, resourceID, resourceType)
+		if err == ErrAccessControlNotFound {
+			return nil
+		} else if err != nil {
+			return
+		}
+		return portainerClient.ResourceControlDelete(resourceControl.ID)
+	}
+
+	// We may be creating a new access control
+	_, err = portainerClient.ResourceControlCreate(client.ResourceControlCreateOptions{
+		ResourceID: resourceID,
+		Type:       resourceType,
+		Public:     accessControl.Public,
+		Users:      accessControl.Users,
+		Teams:      accessControl.Teams,
+	})
+	if !IsConflictError(err) {
+		return
+	}
+
+	// We are updating an existing access control
+	resourceControl, err := GetPortainerAccessControl(endpointID, resourceID, resourceType)
+	if err != nil {
+		return
+	}
+	_, err = portainerClient.ResourceControlUpdate(client.ResourceControlUpdateOptions{
+		ID:     resourceControl.ID,
+		Public: accessControl.Public,
+		Users:  accessControl.Users,
+		Teams:  accessControl.Teams,
+	})
+	return
 }
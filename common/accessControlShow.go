@@ -0,0 +1,104 @@
+package common
+
+import (
+	"fmt"
+
+	portainer "github.com/portainer/portainer/api"
+)
+
+// Access control info types
+const (
+	// AccessInfoAdmins means only administrators have access to a resource
+	AccessInfoAdmins = "admins"
+	// AccessInfoPublic means any user has access to a resource
+	AccessInfoPublic = "public"
+	// AccessInfoRestricted means some users and teams (and administrators) have access to a resource
+	AccessInfoRestricted = "restricted"
+)
+
+// AccessControlInfo represents a resource's access control, with its users
+// and teams resolved by name
+type AccessControlInfo struct {
+	// Resource is the resource id or name
+	Resource string
+	// Access is one of admins, public or restricted
+	Access string
+	// Users are the names of the users with access to the resource (or their id if they no longer exist)
+	Users []string
+	// Teams are the names of the teams with access to the resource (or their id if they no longer exist)
+	Teams []string
+	// SubResources are the ids of the resources sharing the access control
+	SubResources []string
+	// ResourceControl is the Portainer resource control (if any)
+	ResourceControl portainer.ResourceControl
+}
+
+// GetAccessInfoType returns the access type (admins, public or restricted)
+// of a resource given its resource control (if found)
+func GetAccessInfoType(resourceControl portainer.ResourceControl, found bool) string {
+	if !found {
+		return AccessInfoAdmins
+	}
+	if resourceControl.Public {
+		return AccessInfoPublic
+	}
+	return AccessInfoRestricted
+}
+
+// GetAccessControlInfo returns the access control of a resource given its
+// resource control (if found), resolving its users and teams names
+func GetAccessControlInfo(resourceID string, resourceControl portainer.ResourceControl, found bool) (info AccessControlInfo, err error) {
+	info = AccessControlInfo{
+		Resource: resourceID,
+		Access:   AccessInfoAdmins,
+	}
+	if !found {
+		return
+	}
+	info.ResourceControl = resourceControl
+	info.SubResources = resourceControl.SubResourceIDs
+	info.Access = GetAccessInfoType(resourceControl, found)
+
+	portainerClient, err := GetClient()
+	if err != nil {
+		return
+	}
+
+	if len(resourceControl.UserAccesses) > 0 {
+		var users []portainer.User
+		users, err = portainerClient.UserList()
+		if err != nil {
+			return
+		}
+		for _, userAccess := range resourceControl.UserAccesses {
+			userName := fmt.Sprint(userAccess.UserID)
+			for _, user := range users {
+				if user.ID == userAccess.UserID {
+					userName = user.Username
+					break
+				}
+			}
+			info.Users = append(info.Users, userName)
+		}
+	}
+
+	if len(resourceControl.TeamAccesses) > 0 {
+		var teams []portainer.Team
+		teams, err = portainerClient.TeamList()
+		if err != nil {
+			return
+		}
+		for _, teamAccess := range resourceControl.TeamAccesses {
+			teamName := fmt.Sprint(teamAccess.TeamID)
+			for _, team := range teams {
+				if team.ID == teamAccess.TeamID {
+					teamName = team.Name
+					break
+				}
+			}
+			info.Teams = append(info.Teams, teamName)
+		}
+	}
+
+	return
+}
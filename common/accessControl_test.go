@@ -0,0 +1,105 @@
+package common
+
+import (
+	"testing"
+
+	portainer "github.com/portainer/portainer/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessControlChanges_Apply(t *testing.T) {
+	type args struct {
+		resourceControl portainer.ResourceControl
+		found           bool
+	}
+	tests := []struct {
+		name    string
+		changes AccessControlChanges
+		args    args
+		want    AccessControl
+	}{
+		{
+			name: "users and teams are added to resources without access control",
+			changes: AccessControlChanges{
+				AddUsers: []portainer.UserID{2},
+				AddTeams: []portainer.TeamID{1},
+			},
+			want: AccessControl{
+				Users: []portainer.UserID{2},
+				Teams: []portainer.TeamID{1},
+			},
+		},
+		{
+			name: "users and teams are added to the existing ones",
+			changes: AccessControlChanges{
+				AddUsers: []portainer.UserID{2, 3},
+				AddTeams: []portainer.TeamID{2},
+			},
+			args: args{
+				resourceControl: portainer.ResourceControl{
+					UserAccesses: []portainer.UserResourceAccess{{UserID: 1}, {UserID: 2}},
+					TeamAccesses: []portainer.TeamResourceAccess{{TeamID: 1}},
+				},
+				found: true,
+			},
+			want: AccessControl{
+				Users: []portainer.UserID{1, 2, 3},
+				Teams: []portainer.TeamID{1, 2},
+			},
+		},
+		{
+			name: "users and teams are removed from the existing ones",
+			changes: AccessControlChanges{
+				RemoveUsers: []portainer.UserID{2},
+				RemoveTeams: []portainer.TeamID{3},
+			},
+			args: args{
+				resourceControl: portainer.ResourceControl{
+					UserAccesses: []portainer.UserResourceAccess{{UserID: 1}, {UserID: 2}},
+					TeamAccesses: []portainer.TeamResourceAccess{{TeamID: 1}},
+				},
+				found: true,
+			},
+			want: AccessControl{
+				Users: []portainer.UserID{1},
+				Teams: []portainer.TeamID{1},
+			},
+		},
+		{
+			name: "resources left without users nor teams get administrators only access",
+			changes: AccessControlChanges{
+				RemoveUsers: []portainer.UserID{1},
+			},
+			args: args{
+				resourceControl: portainer.ResourceControl{
+					UserAccesses: []portainer.UserResourceAccess{{UserID: 1}},
+				},
+				found: true,
+			},
+			want: AccessControl{
+				AdministratorsOnly: true,
+			},
+		},
+		{
+			name: "public resources keep their public access",
+			changes: AccessControlChanges{
+				RemoveUsers: []portainer.UserID{1},
+			},
+			args: args{
+				resourceControl: portainer.ResourceControl{
+					Public:       true,
+					UserAccesses: []portainer.UserResourceAccess{{UserID: 1}},
+				},
+				found: true,
+			},
+			want: AccessControl{
+				Public: true,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.changes.Apply(tt.args.resourceControl, tt.args.found))
+		})
+	}
+}
@@ -0,0 +1,268 @@
+package common
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/greenled/portainer-stack-utils/client"
+	portainer "github.com/portainer/portainer/api"
+	"gopkg.in/yaml.v2"
+)
+
+// Access policy actions
+const (
+	AccessPolicyActionCreate = "create"
+	AccessPolicyActionUpdate = "update"
+	AccessPolicyActionDelete = "delete"
+)
+
+// AccessPolicyHelp is the help string describing the access policy file format
+const AccessPolicyHelp = `
+Policy:
+  The policy is a YAML file mapping resources to their desired access control.
+  Each resource gets the access of the first rule it matches. Resources not
+  matching any rule are left untouched. Rule selectors are optional, and every
+  selector set must match.
+
+  rules:
+    - endpoint: primary        # Endpoint name
+      type: service            # One of stack, service, container, volume, network, secret or config
+      name: "web_*"            # Resource name glob
+      stack: web               # Stack the resource belongs to (by its namespace label)
+      access: private          # One of admins, private or public
+      users: [jdoe]            # Users with access, by name
+      teams: [developers]      # Teams with access, by name
+`
+
+// AccessPolicy represents a set of rules describing the desired access control of resources
+type AccessPolicy struct {
+	Rules []AccessPolicyRule `yaml:"rules"`
+}
+
+// AccessPolicyRule represents the desired access control of the resources matching some selectors
+type AccessPolicyRule struct {
+	Endpoint string              `yaml:"endpoint"`
+	Type     client.ResourceType `yaml:"type"`
+	Name     string              `yaml:"name"`
+	Stack    string              `yaml:"stack"`
+	Access   string              `yaml:"access"`
+	Users    []string            `yaml:"users"`
+	Teams    []string            `yaml:"teams"`
+}
+
+// AccessPolicyChangeInfo describes a change needed to make a resource's
+// access control match an access policy
+type AccessPolicyChangeInfo struct {
+	Endpoint string
+	Type     client.ResourceType
+	ID       string
+	Name     string
+	Action   string
+	// Rule is the (1-based) index of the policy rule the resource matched
+	Rule int
+	// From is the current access (one of admins, public or restricted)
+	From string
+	// To is the desired access (one of admins, public or restricted)
+	To string
+}
+
+// AccessPolicyChange represents a change needed to make a resource's access
+// control match an access policy, along with the data needed to apply it
+type AccessPolicyChange struct {
+	AccessPolicyChangeInfo
+	resourceControl portainer.ResourceControl
+	accessControl   AccessControl
+}
+
+// LoadAccessPolicy loads and validates an access policy file
+func LoadAccessPolicy(path string) (policy AccessPolicy, err error) {
+	policyBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	err = yaml.UnmarshalStrict(policyBytes, &policy)
+	if err != nil {
+		return
+	}
+
+	err = policy.validate()
+	return
+}
+
+// validate checks the policy rules are well formed
+func (p AccessPolicy) validate() error {
+	for i, rule := range p.Rules {
+		if rule.Type != "" && !isAccessControlledResourceType(rule.Type) {
+			return fmt.Errorf("rule #%d in policy has an invalid type %q", i+1, rule.Type)
+		}
+		if rule.Name != "" {
+			if _, err := filepath.Match(rule.Name, ""); err != nil {
+				return fmt.Errorf("rule #%d in policy has an invalid name glob %q: %s", i+1, rule.Name, err)
+			}
+		}
+		switch rule.Access {
+		case AccessModeAdmins, AccessModePublic:
+			if len(rule.Users) > 0 || len(rule.Teams) > 0 {
+				return fmt.Errorf("rule #%d in policy can not give users and teams access along with %s access", i+1, rule.Access)
+			}
+		case AccessModePrivate:
+		case "":
+			if len(rule.Users) == 0 && len(rule.Teams) == 0 {
+				return fmt.Errorf("rule #%d in policy has no access, users nor teams", i+1)
+			}
+		default:
+			return fmt.Errorf("rule #%d in policy has an invalid access %q (must be one of %s)", i+1, rule.Access, strings.Join(AccessModes, ", "))
+		}
+	}
+	return nil
+}
+
+// isAccessControlledResourceType checks if a resource type can have an access control
+func isAccessControlledResourceType(resourceType client.ResourceType) bool {
+	for _, t := range AccessControlledResourceTypes {
+		if t == resourceType {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches checks if a resource in an endpoint is selected by the rule
+func (r AccessPolicyRule) Matches(endpointName string, resource DockerResource) bool {
+	if r.Endpoint != "" && r.Endpoint != endpointName {
+		return false
+	}
+	if r.Type != "" && r.Type != resource.Type {
+		return false
+	}
+	if r.Name != "" {
+		if matched, _ := filepath.Match(r.Name, resource.Name); !matched {
+			return false
+		}
+	}
+	if r.Stack != "" {
+		if resource.Type == client.ResourceStack {
+			return resource.Name == r.Stack
+		}
+		return resource.Labels[SwarmStackNamespaceLabel] == r.Stack || resource.Labels[ComposeStackNamespaceLabel] == r.Stack
+	}
+	return true
+}
+
+// Endpoints returns the names of the endpoints the policy rules are limited
+// to, or nil if any rule applies to all endpoints
+func (p AccessPolicy) Endpoints() (endpointNames []string) {
+	seen := map[string]bool{}
+	for _, rule := range p.Rules {
+		if rule.Endpoint == "" {
+			return nil
+		}
+		if !seen[rule.Endpoint] {
+			seen[rule.Endpoint] = true
+			endpointNames = append(endpointNames, rule.Endpoint)
+		}
+	}
+	return
+}
+
+// GetAccessPolicyChange returns the change needed (if any) to make a
+// resource's access control match the desired one. Access controls inherited
+// from another resource (like a service's from its stack) are not considered
+// the resource's own.
+func GetAccessPolicyChange(resource DockerResource, accessControl AccessControl) (change AccessPolicyChange, needed bool) {
+	found := resource.HasAccessControl() && resource.ResourceControl.ResourceID == resource.ID
+	if accessControl.Matches(resource.ResourceControl, found) {
+		return
+	}
+
+	change = AccessPolicyChange{
+		AccessPolicyChangeInfo: AccessPolicyChangeInfo{
+			Type: resource.Type,
+			ID:   resource.ID,
+			Name: resource.Name,
+			From: GetAccessInfoType(resource.ResourceControl, found),
+			To:   GetAccessInfoType(portainer.ResourceControl{Public: accessControl.Public}, !accessControl.AdministratorsOnly),
+		},
+		resourceControl: resource.ResourceControl,
+		accessControl:   accessControl,
+	}
+	switch {
+	case accessControl.AdministratorsOnly:
+		change.Action = AccessPolicyActionDelete
+	case found:
+		change.Action = AccessPolicyActionUpdate
+	default:
+		change.Action = AccessPolicyActionCreate
+	}
+	return change, true
+}
+
+// ComputeAccessPolicyChanges computes the changes needed to make the access
+// control of the resources in some endpoints match an access policy
+func ComputeAccessPolicyChanges(policy AccessPolicy, endpoints []portainer.Endpoint) (changes []AccessPolicyChange, err error) {
+	accessControls := make([]AccessControl, len(policy.Rules))
+	for i, rule := range policy.Rules {
+		accessControls[i], err = GetAccessControl(rule.Access, rule.Users, rule.Teams)
+		if err != nil {
+			err = fmt.Errorf("rule #%d in policy: %s", i+1, err)
+			return
+		}
+	}
+
+	for _, endpoint := range endpoints {
+		var resources []DockerResource
+		resources, err = GetEndpointResources(endpoint)
+		if err != nil {
+			err = fmt.Errorf("could not get resources in endpoint %s: %s", endpoint.Name, err)
+			return
+		}
+
+		for _, resource := range resources {
+			for i, rule := range policy.Rules {
+				if !rule.Matches(endpoint.Name, resource) {
+					continue
+				}
+				if change, needed := GetAccessPolicyChange(resource, accessControls[i]); needed {
+					change.Endpoint = endpoint.Name
+					change.Rule = i + 1
+					changes = append(changes, change)
+				}
+				break
+			}
+		}
+	}
+
+	return
+}
+
+// ApplyAccessPolicyChange creates, updates or deletes a resource control
+func ApplyAccessPolicyChange(change AccessPolicyChange) (err error) {
+	portainerClient, err := GetClient()
+	if err != nil {
+		return
+	}
+
+	switch change.Action {
+	case AccessPolicyActionCreate:
+		_, err = portainerClient.ResourceControlCreate(client.ResourceControlCreateOptions{
+			ResourceID: change.ID,
+			Type:       change.Type,
+			Public:     change.accessControl.Public,
+			Users:      change.accessControl.Users,
+			Teams:      change.accessControl.Teams,
+		})
+	case AccessPolicyActionUpdate:
+		_, err = portainerClient.ResourceControlUpdate(client.ResourceControlUpdateOptions{
+			ID:     change.resourceControl.ID,
+			Public: change.accessControl.Public,
+			Users:  change.accessControl.Users,
+			Teams:  change.accessControl.Teams,
+		})
+	case AccessPolicyActionDelete:
+		err = portainerClient.ResourceControlDelete(change.resourceControl.ID)
+	}
+	return
+}
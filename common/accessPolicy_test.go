@@ -0,0 +1,199 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/greenled/portainer-stack-utils/client"
+	portainer "github.com/portainer/portainer/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessPolicy_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  AccessPolicy
+		wantErr bool
+	}{
+		{
+			name: "valid rules",
+			policy: AccessPolicy{Rules: []AccessPolicyRule{
+				{Type: client.ResourceStack, Name: "review-*", Access: AccessModePublic},
+				{Stack: "web", Access: AccessModePrivate, Teams: []string{"devs"}},
+				{Users: []string{"bob"}},
+			}},
+		},
+		{
+			name:    "invalid type",
+			policy:  AccessPolicy{Rules: []AccessPolicyRule{{Type: "image", Access: AccessModePublic}}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid name glob",
+			policy:  AccessPolicy{Rules: []AccessPolicyRule{{Name: "web_[", Access: AccessModePublic}}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid access",
+			policy:  AccessPolicy{Rules: []AccessPolicyRule{{Access: "everyone"}}},
+			wantErr: true,
+		},
+		{
+			name:    "users along with public access",
+			policy:  AccessPolicy{Rules: []AccessPolicyRule{{Access: AccessModePublic, Users: []string{"bob"}}}},
+			wantErr: true,
+		},
+		{
+			name:    "no access, users nor teams",
+			policy:  AccessPolicy{Rules: []AccessPolicyRule{{Type: client.ResourceStack}}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestAccessPolicyRule_Matches(t *testing.T) {
+	service := DockerResource{
+		ID:     "abc",
+		Name:   "web_app",
+		Type:   client.ResourceService,
+		Labels: map[string]string{SwarmStackNamespaceLabel: "web"},
+	}
+	stack := DockerResource{
+		ID:   "web",
+		Name: "web",
+		Type: client.ResourceStack,
+	}
+	tests := []struct {
+		name     string
+		rule     AccessPolicyRule
+		resource DockerResource
+		want     bool
+	}{
+		{
+			name:     "rule without selectors matches any resource",
+			rule:     AccessPolicyRule{},
+			resource: service,
+			want:     true,
+		},
+		{
+			name:     "endpoint selector",
+			rule:     AccessPolicyRule{Endpoint: "secondary"},
+			resource: service,
+			want:     false,
+		},
+		{
+			name:     "type selector",
+			rule:     AccessPolicyRule{Type: client.ResourceVolume},
+			resource: service,
+			want:     false,
+		},
+		{
+			name:     "name glob selector",
+			rule:     AccessPolicyRule{Name: "web_*"},
+			resource: service,
+			want:     true,
+		},
+		{
+			name:     "stack selector matches resources by namespace label",
+			rule:     AccessPolicyRule{Stack: "web"},
+			resource: service,
+			want:     true,
+		},
+		{
+			name:     "stack selector matches stacks by name",
+			rule:     AccessPolicyRule{Stack: "web"},
+			resource: stack,
+			want:     true,
+		},
+		{
+			name:     "every selector must match",
+			rule:     AccessPolicyRule{Stack: "web", Name: "db_*"},
+			resource: service,
+			want:     false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.rule.Matches("primary", tt.resource))
+		})
+	}
+}
+
+func TestAccessPolicy_Endpoints(t *testing.T) {
+	assert.Equal(t, []string{"primary", "secondary"}, AccessPolicy{Rules: []AccessPolicyRule{
+		{Endpoint: "primary"},
+		{Endpoint: "secondary"},
+		{Endpoint: "primary"},
+	}}.Endpoints())
+	assert.Nil(t, AccessPolicy{Rules: []AccessPolicyRule{
+		{Endpoint: "primary"},
+		{},
+	}}.Endpoints())
+}
+
+func TestGetAccessPolicyChange(t *testing.T) {
+	ownControl := portainer.ResourceControl{ID: 1, ResourceID: "abc", Public: true}
+	inheritedControl := portainer.ResourceControl{ID: 2, ResourceID: "web", Public: true}
+	tests := []struct {
+		name          string
+		resource      DockerResource
+		accessControl AccessControl
+		wantAction    string
+		wantNeeded    bool
+	}{
+		{
+			name:          "matching access control",
+			resource:      DockerResource{ID: "abc", ResourceControl: ownControl},
+			accessControl: AccessControl{Public: true},
+		},
+		{
+			name:          "resource without access control",
+			resource:      DockerResource{ID: "abc"},
+			accessControl: AccessControl{Users: []portainer.UserID{1}},
+			wantAction:    AccessPolicyActionCreate,
+			wantNeeded:    true,
+		},
+		{
+			name:          "resource with a different access control",
+			resource:      DockerResource{ID: "abc", ResourceControl: ownControl},
+			accessControl: AccessControl{Users: []portainer.UserID{1}},
+			wantAction:    AccessPolicyActionUpdate,
+			wantNeeded:    true,
+		},
+		{
+			name:          "resource with access control limited to administrators",
+			resource:      DockerResource{ID: "abc", ResourceControl: ownControl},
+			accessControl: AccessControl{AdministratorsOnly: true},
+			wantAction:    AccessPolicyActionDelete,
+			wantNeeded:    true,
+		},
+		{
+			name:          "inherited access controls are not updated",
+			resource:      DockerResource{ID: "abc", ResourceControl: inheritedControl},
+			accessControl: AccessControl{Public: true},
+			wantAction:    AccessPolicyActionCreate,
+			wantNeeded:    true,
+		},
+		{
+			name:          "inherited access controls are not deleted",
+			resource:      DockerResource{ID: "abc", ResourceControl: inheritedControl},
+			accessControl: AccessControl{AdministratorsOnly: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			change, needed := GetAccessPolicyChange(tt.resource, tt.accessControl)
+			assert.Equal(t, tt.wantNeeded, needed)
+			assert.Equal(t, tt.wantAction, change.Action)
+		})
+	}
+}
@@ -0,0 +1,470 @@
+package common
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v2"
+)
+
+// composeFile represents a loaded stack file
+type composeFile struct {
+	path     string
+	document yaml.MapSlice
+}
+
+// loadComposeFile reads and parses a stack file
+func loadComposeFile(path string) (file composeFile, err error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	file.path = path
+	err = yaml.Unmarshal(content, &file.document)
+	if err != nil {
+		err = fmt.Errorf("invalid stack file %s: %s", path, err)
+	}
+	return
+}
+
+// services returns the services defined in a stack file
+func (f composeFile) services() (services yaml.MapSlice, err error) {
+	value, _ := getYAMLMapValue(f.document, "services")
+	if value == nil {
+		return
+	}
+	services, isMap := value.(yaml.MapSlice)
+	if !isMap {
+		err = fmt.Errorf("invalid stack file %s: services must be a mapping", f.path)
+	}
+	return
+}
+
+// ResolveStackFile loads a stack file and resolves its references to other
+// local files (relative to the stack file), so it can be uploaded to Portainer
+// as a self-contained document:
+//
+// - Services extending other services (in the same or other files) are merged with them.
+// - Service env_file entries are loaded into the service environment.
+//
+// Relative build contexts and bind mount sources of services extended from
+// other files are made relative to the stack file.
+// The stack file content is returned as it is when it has no references to
+// resolve. An error is returned for references which can not be resolved.
+// Configs and secrets created from local files are left untouched, see
+// PrepareStackFileSources.
+func ResolveStackFile(path string) (content string, err error) {
+	contentBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	content = string(contentBytes)
+
+	file, err := loadComposeFile(path)
+	if err != nil {
+		return
+	}
+	services, err := file.services()
+	if err != nil {
+		return
+	}
+
+	var resolved bool
+	resolvedServices := yaml.MapSlice{}
+	for _, service := range services {
+		serviceName := fmt.Sprint(service.Key)
+		serviceDefinition, serviceResolved, resolvingErr := resolveComposeService(file, serviceName, nil)
+		if resolvingErr != nil {
+			err = resolvingErr
+			return
+		}
+		if _, hasEnvFiles := getYAMLMapValue(serviceDefinition, "env_file"); hasEnvFiles {
+			serviceDefinition, err = loadComposeEnvFiles(serviceName, serviceDefinition)
+			if err != nil {
+				return
+			}
+		}
+		resolved = resolved || serviceResolved
+		resolvedServices = append(resolvedServices, yaml.MapItem{
+			Key:   service.Key,
+			Value: serviceDefinition,
+		})
+	}
+	if !resolved {
+		return
+	}
+
+	resolvedContentBytes, err := yaml.Marshal(setYAMLMapValue(file.document, "services", resolvedServices))
+	if err != nil {
+		return
+	}
+	content = string(resolvedContentBytes)
+	return
+}
+
+// resolveComposeService returns a service definition merged with the
+// services it extends, and with its env_file entries resolved relative to
+// the current directory (but not loaded yet). Chain holds the services being
+// extended, to detect cycles.
+func resolveComposeService(file composeFile, serviceName string, chain []string) (definition yaml.MapSlice, resolved bool, err error) {
+	serviceID := fmt.Sprintf("%s#%s", file.path, serviceName)
+	for _, chainedServiceID := range chain {
+		if chainedServiceID == serviceID {
+			err = fmt.Errorf("service %q in %s extends itself: %s", serviceName, file.path, strings.Join(append(chain, serviceID), " -> "))
+			return
+		}
+	}
+	chain = append(chain, serviceID)
+
+	services, err := file.services()
+	if err != nil {
+		return
+	}
+	value, found := getYAMLMapValue(services, serviceName)
+	if !found {
+		err = fmt.Errorf("service %q not found in %s", serviceName, file.path)
+		return
+	}
+	if value != nil {
+		var isMap bool
+		definition, isMap = value.(yaml.MapSlice)
+		if !isMap {
+			err = fmt.Errorf("invalid service %q in %s: it must be a mapping", serviceName, file.path)
+			return
+		}
+	}
+
+	if envFiles, hasEnvFiles := getYAMLMapValue(definition, "env_file"); hasEnvFiles {
+		var paths []interface{}
+		switch envFiles := envFiles.(type) {
+		case string:
+			paths = []interface{}{resolveComposeFilePath(file, envFiles)}
+		case []interface{}:
+			for _, path := range envFiles {
+				paths = append(paths, resolveComposeFilePath(file, fmt.Sprint(path)))
+			}
+		default:
+			err = fmt.Errorf("invalid env_file in service %q in %s: it must be a string or a list", serviceName, file.path)
+			return
+		}
+		definition = setYAMLMapValue(definition, "env_file", paths)
+		resolved = true
+	}
+
+	if extends, hasExtends := getYAMLMapValue(definition, "extends"); hasExtends {
+		var baseFile composeFile
+		var baseServiceName string
+		baseFile, baseServiceName, err = getComposeExtendedService(file, serviceName, extends)
+		if err != nil {
+			return
+		}
+		var baseDefinition yaml.MapSlice
+		baseDefinition, _, err = resolveComposeService(baseFile, baseServiceName, chain)
+		if err != nil {
+			return
+		}
+		if baseFile.path != file.path {
+			err = checkComposeExtendedServiceReferences(file, serviceName, baseFile, baseServiceName, baseDefinition)
+			if err != nil {
+				return
+			}
+			baseDefinition, err = rebaseComposeServicePaths(baseDefinition, baseFile, file)
+			if err != nil {
+				return
+			}
+		}
+		definition = mergeComposeMaps(baseDefinition, deleteYAMLMapValue(definition, "extends"))
+		resolved = true
+	}
+
+	return
+}
+
+// getComposeExtendedService returns the file and name of the service
+// referenced by an extends entry
+func getComposeExtendedService(file composeFile, serviceName string, extends interface{}) (baseFile composeFile, baseServiceName string, err error) {
+	baseFile = file
+	switch extends := extends.(type) {
+	case string:
+		baseServiceName = extends
+	case yaml.MapSlice:
+		service, _ := getYAMLMapValue(extends, "service")
+		baseServiceName, _ = service.(string)
+		if path, hasFile := getYAMLMapValue(extends, "file"); hasFile {
+			pathString, _ := path.(string)
+			baseFile, err = loadComposeFile(resolveComposeFilePath(file, pathString))
+			if err != nil {
+				return
+			}
+		}
+	}
+	if baseServiceName == "" {
+		err = fmt.Errorf("invalid extends in service %q in %s: it must have a service name", serviceName, file.path)
+	}
+	return
+}
+
+// checkComposeExtendedServiceReferences checks the configs and secrets used
+// by a service extended from another file are declared in the extending file,
+// as top-level declarations are not inherited along with the service
+func checkComposeExtendedServiceReferences(file composeFile, serviceName string, baseFile composeFile, baseServiceName string, baseDefinition yaml.MapSlice) error {
+	for _, field := range []string{"configs", "secrets"} {
+		references, _ := getYAMLMapValue(baseDefinition, field)
+		referencesList, _ := references.([]interface{})
+		declarations, _ := getYAMLMapValue(file.document, field)
+		declarationsMap, _ := declarations.(yaml.MapSlice)
+		for _, reference := range referencesList {
+			name := reference
+			if referenceMap, isMap := reference.(yaml.MapSlice); isMap {
+				name, _ = getYAMLMapValue(referenceMap, "source")
+			}
+			if _, declared := getYAMLMapValue(declarationsMap, name); !declared {
+				return fmt.Errorf("service %q in %s can not be inlined: %s %q used by extended service %q in %s is not declared in %s", serviceName, file.path, field, fmt.Sprint(name), baseServiceName, baseFile.path, file.path)
+			}
+		}
+	}
+	return nil
+}
+
+// rebaseComposeServicePaths makes the relative build context and bind mount
+// sources of a service definition read from a stack file relative to another
+// stack file's directory
+func rebaseComposeServicePaths(definition yaml.MapSlice, from, to composeFile) (rebased yaml.MapSlice, err error) {
+	rebased = definition
+	fromDir, err := filepath.Abs(filepath.Dir(from.path))
+	if err != nil {
+		return
+	}
+	toDir, err := filepath.Abs(filepath.Dir(to.path))
+	if err != nil || fromDir == toDir {
+		return
+	}
+	rebasePath := func(path string) (string, error) {
+		if filepath.IsAbs(path) {
+			return path, nil
+		}
+		rebasedPath, err := filepath.Rel(toDir, filepath.Join(fromDir, path))
+		if err != nil {
+			return "", err
+		}
+		if !strings.HasPrefix(rebasedPath, ".") {
+			// Keep the path from being taken as a volume name
+			rebasedPath = "./" + rebasedPath
+		}
+		return filepath.ToSlash(rebasedPath), nil
+	}
+
+	if build, hasBuild := getYAMLMapValue(rebased, "build"); hasBuild {
+		switch build := build.(type) {
+		case string:
+			var context string
+			context, err = rebasePath(build)
+			if err != nil {
+				return
+			}
+			rebased = setYAMLMapValue(rebased, "build", context)
+		case yaml.MapSlice:
+			if context, hasContext := getYAMLMapValue(build, "context"); hasContext {
+				var rebasedContext string
+				rebasedContext, err = rebasePath(fmt.Sprint(context))
+				if err != nil {
+					return
+				}
+				rebased = setYAMLMapValue(rebased, "build", setYAMLMapValue(build, "context", rebasedContext))
+			}
+		}
+	}
+
+	if volumes, hasVolumes := getYAMLMapValue(rebased, "volumes"); hasVolumes {
+		volumesList, _ := volumes.([]interface{})
+		var rebasedVolumes []interface{}
+		for _, volume := range volumesList {
+			switch volume := volume.(type) {
+			case string:
+				// Bind mount sources are paths starting with a dot or a slash
+				volumeParts := strings.SplitN(volume, ":", 2)
+				if len(volumeParts) == 2 && strings.HasPrefix(volumeParts[0], ".") {
+					var source string
+					source, err = rebasePath(volumeParts[0])
+					if err != nil {
+						return
+					}
+					rebasedVolumes = append(rebasedVolumes, source+":"+volumeParts[1])
+					continue
+				}
+			case yaml.MapSlice:
+				if source, hasSource := getYAMLMapValue(volume, "source"); hasSource && strings.HasPrefix(fmt.Sprint(source), ".") {
+					var rebasedSource string
+					rebasedSource, err = rebasePath(fmt.Sprint(source))
+					if err != nil {
+						return
+					}
+					rebasedVolumes = append(rebasedVolumes, setYAMLMapValue(volume, "source", rebasedSource))
+					continue
+				}
+			}
+			rebasedVolumes = append(rebasedVolumes, volume)
+		}
+		if volumesList != nil {
+			rebased = setYAMLMapValue(rebased, "volumes", rebasedVolumes)
+		}
+	}
+
+	return
+}
+
+// loadComposeEnvFiles loads a service's (already resolved) env_file entries
+// into its environment. Later files take precedence over former ones, and
+// variables set in the service environment take precedence over all of them.
+// Values are escaped, as environment values are interpolated on deployment
+// but env_file ones are not.
+func loadComposeEnvFiles(serviceName string, definition yaml.MapSlice) (resolvedDefinition yaml.MapSlice, err error) {
+	envFiles, _ := getYAMLMapValue(definition, "env_file")
+	paths, _ := envFiles.([]interface{})
+
+	environment := yaml.MapSlice{}
+	for _, path := range paths {
+		var variables map[string]string
+		variables, err = godotenv.Read(fmt.Sprint(path))
+		if err != nil {
+			err = fmt.Errorf("could not load env_file of service %q: %s", serviceName, err)
+			return
+		}
+		var names []string
+		for name := range variables {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		variablesMap := yaml.MapSlice{}
+		for _, name := range names {
+			variablesMap = append(variablesMap, yaml.MapItem{
+				Key:   name,
+				Value: strings.Replace(variables[name], "$", "$$", -1),
+			})
+		}
+		environment = mergeComposeMaps(environment, variablesMap)
+	}
+
+	currentEnvironment, _ := getYAMLMapValue(definition, "environment")
+	environment = mergeComposeMaps(environment, normalizeComposeKeyValues(currentEnvironment))
+	resolvedDefinition = setYAMLMapValue(deleteYAMLMapValue(definition, "env_file"), "environment", environment)
+	return
+}
+
+// resolveComposeFilePath returns a path relative to a stack file's directory
+func resolveComposeFilePath(file composeFile, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(file.path), path)
+}
+
+// mergeComposeMaps merges an overriding mapping into a base one, the way
+// Docker Compose merges extended services: mappings are merged recursively,
+// environment and labels are merged by key (no matter if they are written
+// as mappings or lists), other lists are concatenated and any other value is
+// replaced.
+func mergeComposeMaps(base, override yaml.MapSlice) (merged yaml.MapSlice) {
+	merged = append(yaml.MapSlice{}, base...)
+	for _, item := range override {
+		baseValue, inBase := getYAMLMapValue(merged, item.Key)
+		if !inBase {
+			merged = append(merged, item)
+			continue
+		}
+
+		value := item.Value
+		key := fmt.Sprint(item.Key)
+		if key == "environment" || key == "labels" {
+			value = mergeComposeMaps(normalizeComposeKeyValues(baseValue), normalizeComposeKeyValues(item.Value))
+		} else if baseMap, isMap := baseValue.(yaml.MapSlice); isMap {
+			if overrideMap, isMap := item.Value.(yaml.MapSlice); isMap {
+				value = mergeComposeMaps(baseMap, overrideMap)
+			}
+		} else if baseList, isList := baseValue.([]interface{}); isList {
+			if overrideList, isList := item.Value.([]interface{}); isList {
+				value = mergeComposeLists(baseList, overrideList)
+			}
+		}
+		merged = setYAMLMapValue(merged, item.Key, value)
+	}
+	return
+}
+
+// mergeComposeLists concatenates two lists, skipping duplicated values
+func mergeComposeLists(base, override []interface{}) (merged []interface{}) {
+	merged = append([]interface{}{}, base...)
+	for _, overrideValue := range override {
+		var duplicated bool
+		for _, baseValue := range base {
+			if fmt.Sprint(baseValue) == fmt.Sprint(overrideValue) {
+				duplicated = true
+				break
+			}
+		}
+		if !duplicated {
+			merged = append(merged, overrideValue)
+		}
+	}
+	return
+}
+
+// normalizeComposeKeyValues converts environment or labels entries written
+// as a list of "KEY=VALUE" strings to a mapping
+func normalizeComposeKeyValues(value interface{}) (normalized yaml.MapSlice) {
+	switch value := value.(type) {
+	case yaml.MapSlice:
+		normalized = value
+	case []interface{}:
+		for _, entry := range value {
+			entryParts := strings.SplitN(fmt.Sprint(entry), "=", 2)
+			item := yaml.MapItem{
+				Key: entryParts[0],
+			}
+			if len(entryParts) == 2 {
+				item.Value = entryParts[1]
+			}
+			normalized = append(normalized, item)
+		}
+	}
+	return
+}
+
+// getYAMLMapValue returns the value of a key in a mapping, and whether it was found
+func getYAMLMapValue(m yaml.MapSlice, key interface{}) (value interface{}, found bool) {
+	for _, item := range m {
+		if fmt.Sprint(item.Key) == fmt.Sprint(key) {
+			return item.Value, true
+		}
+	}
+	return nil, false
+}
+
+// setYAMLMapValue sets the value of a key in a mapping, keeping the keys order
+func setYAMLMapValue(m yaml.MapSlice, key interface{}, value interface{}) yaml.MapSlice {
+	result := append(yaml.MapSlice{}, m...)
+	for i := range result {
+		if fmt.Sprint(result[i].Key) == fmt.Sprint(key) {
+			result[i].Value = value
+			return result
+		}
+	}
+	return append(result, yaml.MapItem{
+		Key:   key,
+		Value: value,
+	})
+}
+
+// deleteYAMLMapValue removes a key from a mapping
+func deleteYAMLMapValue(m yaml.MapSlice, key interface{}) (result yaml.MapSlice) {
+	for _, item := range m {
+		if fmt.Sprint(item.Key) != fmt.Sprint(key) {
+			result = append(result, item)
+		}
+	}
+	return
+}
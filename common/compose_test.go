@@ -0,0 +1,327 @@
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveStackFile(t *testing.T) {
+	tests := []struct {
+		name        string
+		files       map[string]string
+		wantContent string
+		wantErr     bool
+	}{
+		{
+			name: "stack file without references is returned as it is",
+			files: map[string]string{
+				"stack.yml": `version: "3.7"
+services:
+  web:   # keeps formatting
+    image: nginx
+`,
+			},
+			wantContent: `version: "3.7"
+services:
+  web:   # keeps formatting
+    image: nginx
+`,
+		},
+		{
+			name: "services extending services in other files are merged with them",
+			files: map[string]string{
+				"stack.yml": `version: "3.7"
+services:
+  web:
+    extends:
+      file: common/base.yml
+      service: base
+    image: nginx:alpine
+    environment:
+      - MODE=production
+    ports:
+      - "80:80"
+`,
+				"common/base.yml": `version: "3.7"
+services:
+  base:
+    image: nginx
+    environment:
+      MODE: development
+      LOG_LEVEL: info
+    ports:
+      - "8080:8080"
+    deploy:
+      replicas: 2
+`,
+			},
+			wantContent: `version: "3.7"
+services:
+  web:
+    image: nginx:alpine
+    environment:
+      MODE: production
+      LOG_LEVEL: info
+    ports:
+    - 8080:8080
+    - 80:80
+    deploy:
+      replicas: 2
+`,
+		},
+		{
+			name: "services extending services in the same file are merged with them",
+			files: map[string]string{
+				"stack.yml": `version: "3.7"
+services:
+  base:
+    image: nginx
+    labels:
+      a: "1"
+  web:
+    extends: base
+    labels:
+      - b=2
+`,
+			},
+			wantContent: `version: "3.7"
+services:
+  base:
+    image: nginx
+    labels:
+      a: "1"
+  web:
+    image: nginx
+    labels:
+      a: "1"
+      b: "2"
+`,
+		},
+		{
+			name: "env files are loaded relative to the file declaring them",
+			files: map[string]string{
+				"stack.yml": `version: "3.7"
+services:
+  web:
+    extends:
+      file: common/base.yml
+      service: base
+    env_file: web.env
+    environment:
+      B: from-environment
+`,
+				"web.env": "A=from-web-env\nB=from-web-env\n",
+				"common/base.yml": `version: "3.7"
+services:
+  base:
+    image: nginx
+    env_file:
+      - base.env
+`,
+				"common/base.env": "A=from-base-env\nC=from-base-env\n",
+			},
+			wantContent: `version: "3.7"
+services:
+  web:
+    image: nginx
+    environment:
+      A: from-web-env
+      C: from-base-env
+      B: from-environment
+`,
+		},
+		{
+			name: "dollar signs in env file values are escaped",
+			files: map[string]string{
+				"stack.yml": `version: "3.7"
+services:
+  web:
+    image: nginx
+    env_file: web.env
+`,
+				"web.env": "PASSWORD=pa$word\n",
+			},
+			wantContent: `version: "3.7"
+services:
+  web:
+    image: nginx
+    environment:
+      PASSWORD: pa$$word
+`,
+		},
+		{
+			name: "variable references in env file values are escaped",
+			files: map[string]string{
+				"stack.yml": `version: "3.7"
+services:
+  web:
+    image: nginx
+    env_file: web.env
+`,
+				"web.env": "TOKEN='${NOT_A_VARIABLE}'\n",
+			},
+			wantContent: `version: "3.7"
+services:
+  web:
+    image: nginx
+    environment:
+      TOKEN: $${NOT_A_VARIABLE}
+`,
+		},
+		{
+			name: "relative paths of services extended from other files are made relative to the stack file",
+			files: map[string]string{
+				"stack.yml": `version: "3.7"
+services:
+  web:
+    extends:
+      file: common/base.yml
+      service: base
+`,
+				"common/base.yml": `version: "3.7"
+services:
+  base:
+    build:
+      context: ./app
+      dockerfile: Dockerfile.prod
+    volumes:
+      - ./data:/data
+      - cache:/cache
+      - /var/log:/var/log
+      - type: bind
+        source: ../logs
+        target: /logs
+`,
+			},
+			wantContent: `version: "3.7"
+services:
+  web:
+    build:
+      context: ./common/app
+      dockerfile: Dockerfile.prod
+    volumes:
+    - ./common/data:/data
+    - cache:/cache
+    - /var/log:/var/log
+    - type: bind
+      source: ./logs
+      target: /logs
+`,
+		},
+		{
+			name: "configs of services extended from other files not declared in the stack file fail",
+			files: map[string]string{
+				"stack.yml": `version: "3.7"
+services:
+  web:
+    extends:
+      file: common/base.yml
+      service: base
+`,
+				"common/base.yml": `version: "3.7"
+services:
+  base:
+    image: nginx
+    configs:
+      - source: nginx_config
+        target: /etc/nginx/nginx.conf
+configs:
+  nginx_config:
+    file: ./nginx.conf
+`,
+			},
+			wantErr: true,
+		},
+		{
+			name: "configs of services extended from other files declared in the stack file are kept",
+			files: map[string]string{
+				"stack.yml": `version: "3.7"
+services:
+  web:
+    extends:
+      file: common/base.yml
+      service: base
+secrets:
+  db_password:
+    external: true
+`,
+				"common/base.yml": `version: "3.7"
+services:
+  base:
+    image: nginx
+    secrets:
+      - db_password
+`,
+			},
+			wantContent: `version: "3.7"
+services:
+  web:
+    image: nginx
+    secrets:
+    - db_password
+secrets:
+  db_password:
+    external: true
+`,
+		},
+		{
+			name: "missing extended services fail",
+			files: map[string]string{
+				"stack.yml": `version: "3.7"
+services:
+  web:
+    extends: base
+`,
+			},
+			wantErr: true,
+		},
+		{
+			name: "services extending themselves fail",
+			files: map[string]string{
+				"stack.yml": `version: "3.7"
+services:
+  web:
+    extends: worker
+  worker:
+    extends: web
+`,
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing env files fail",
+			files: map[string]string{
+				"stack.yml": `version: "3.7"
+services:
+  web:
+    image: nginx
+    env_file: missing.env
+`,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "psu")
+			assert.Nil(t, err)
+			defer os.RemoveAll(dir)
+			for path, content := range tt.files {
+				path = filepath.Join(dir, path)
+				assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0755))
+				assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0644))
+			}
+
+			gotContent, err := ResolveStackFile(filepath.Join(dir, "stack.yml"))
+			assert.Equal(t, tt.wantErr, err != nil)
+			if tt.wantErr {
+				return
+			}
+			assert.Equal(t, tt.wantContent, gotContent)
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	portainer "github.com/portainer/portainer/api"
+	"github.com/sirupsen/logrus"
+)
+
+// Convergence errors
+const (
+	ErrStackNotConverged = Error("Stack not converged")
+)
+
+const stackConvergenceRetryInterval = 2 * time.Second
+
+// dockerService represents a Swarm service as returned by the Docker API
+type dockerService struct {
+	ID   string
+	Spec struct {
+		Name string
+		Mode struct {
+			Replicated *struct {
+				Replicas *uint64
+			}
+			Global *struct{}
+		}
+	}
+	UpdateStatus *struct {
+		State   string
+		Message string
+	}
+}
+
+// dockerTask represents a Swarm task as returned by the Docker API
+type dockerTask struct {
+	ID     string
+	Status struct {
+		State string
+		Err   string
+	}
+}
+
+// dockerContainer represents a container as returned by the Docker API list operation
+type dockerContainer struct {
+	ID     string
+	Names  []string
+	State  string
+	Status string
+}
+
+// WaitForStackConvergence waits up to a given timeout for all the services of
+// a stack to be up and running (and healthy, if they have a health check).
+// Swarm services must have all their replicas running and no update in
+// progress, and Compose containers must be running and not unhealthy.
+func WaitForStackConvergence(endpointID portainer.EndpointID, stack portainer.Stack, timeout time.Duration) (err error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		var pending []string
+		if stack.Type == portainer.DockerComposeStack {
+			pending, err = getComposeStackPendingContainers(endpointID, stack)
+		} else {
+			pending, err = getSwarmStackPendingServices(endpointID, stack)
+		}
+		if err != nil {
+			return
+		}
+
+		if len(pending) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s after %s: %s", ErrStackNotConverged, timeout, strings.Join(pending, ", "))
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"stack":   stack.Name,
+			"pending": strings.Join(pending, ","),
+		}).Info("Waiting for stack to converge")
+		time.Sleep(stackConvergenceRetryInterval)
+	}
+}
+
+// getSwarmStackPendingServices returns a description of the Swarm stack
+// services which have not converged yet. Failed or paused service updates
+// are reported as errors, as they will not converge by themselves.
+func getSwarmStackPendingServices(endpointID portainer.EndpointID, stack portainer.Stack) (pending []string, err error) {
+	portainerClient, err := GetClient()
+	if err != nil {
+		return
+	}
+
+	filtersJSONBytes, _ := json.Marshal(map[string][]string{
+		"label": {GetStackNamespaceLabel(stack)},
+	})
+	var services []dockerService
+	err = portainerClient.DoJSONWithToken(fmt.Sprintf("endpoints/%d/docker/services?filters=%s", endpointID, url.QueryEscape(string(filtersJSONBytes))), http.MethodGet, http.Header{}, nil, &services)
+	if err != nil {
+		return
+	}
+
+	for _, service := range services {
+		if service.UpdateStatus != nil {
+			switch service.UpdateStatus.State {
+			case "paused", "rollback_started", "rollback_paused", "rollback_completed":
+				err = fmt.Errorf("service %s update %s: %s", service.Spec.Name, strings.Replace(service.UpdateStatus.State, "_", " ", -1), service.UpdateStatus.Message)
+				return
+			case "updating":
+				pending = append(pending, fmt.Sprintf("%s (updating)", service.Spec.Name))
+				continue
+			}
+		}
+
+		filtersJSONBytes, _ := json.Marshal(map[string][]string{
+			"service":       {service.ID},
+			"desired-state": {"running"},
+		})
+		var tasks []dockerTask
+		err = portainerClient.DoJSONWithToken(fmt.Sprintf("endpoints/%d/docker/tasks?filters=%s", endpointID, url.QueryEscape(string(filtersJSONBytes))), http.MethodGet, http.Header{}, nil, &tasks)
+		if err != nil {
+			return
+		}
+
+		desiredReplicas := uint64(len(tasks))
+		if service.Spec.Mode.Replicated != nil && service.Spec.Mode.Replicated.Replicas != nil {
+			desiredReplicas = *service.Spec.Mode.Replicated.Replicas
+		}
+		var runningReplicas uint64
+		var lastTaskErr string
+		for _, task := range tasks {
+			if task.Status.State == "running" {
+				runningReplicas++
+			} else if task.Status.Err != "" {
+				lastTaskErr = task.Status.Err
+			}
+		}
+		if runningReplicas < desiredReplicas {
+			description := fmt.Sprintf("%s (%d/%d running)", service.Spec.Name, runningReplicas, desiredReplicas)
+			if lastTaskErr != "" {
+				description = fmt.Sprintf("%s (%d/%d running, %s)", service.Spec.Name, runningReplicas, desiredReplicas, lastTaskErr)
+			}
+			pending = append(pending, description)
+		}
+	}
+
+	return
+}
+
+// getComposeStackPendingContainers returns a description of the Compose
+// stack containers which are not running or healthy yet
+func getComposeStackPendingContainers(endpointID portainer.EndpointID, stack portainer.Stack) (pending []string, err error) {
+	portainerClient, err := GetClient()
+	if err != nil {
+		return
+	}
+
+	filtersJSONBytes, _ := json.Marshal(map[string][]string{
+		"label": {GetStackNamespaceLabel(stack)},
+	})
+	var containers []dockerContainer
+	err = portainerClient.DoJSONWithToken(fmt.Sprintf("endpoints/%d/docker/containers/json?all=1&filters=%s", endpointID, url.QueryEscape(string(filtersJSONBytes))), http.MethodGet, http.Header{}, nil, &containers)
+	if err != nil {
+		return
+	}
+
+	for _, container := range containers {
+		var name string
+		if len(container.Names) > 0 {
+			name = strings.TrimPrefix(container.Names[0], "/")
+		}
+		if container.State != "running" || strings.Contains(container.Status, "(health: starting)") || strings.Contains(container.Status, "(unhealthy)") {
+			pending = append(pending, fmt.Sprintf("%s (%s)", name, container.Status))
+		}
+	}
+
+	return
+}
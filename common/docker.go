@@ -0,0 +1,314 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/greenled/portainer-stack-utils/client"
+	portainer "github.com/portainer/portainer/api"
+)
+
+// Docker labels used to identify the resources created for a stack
+const (
+	SwarmStackNamespaceLabel   = "com.docker.stack.namespace"
+	ComposeStackNamespaceLabel = "com.docker.compose.project"
+)
+
+// DockerResource represents a Docker resource retrieved through an endpoint's Docker API proxy
+type DockerResource struct {
+	ID              string
+	Name            string
+	Type            client.ResourceType
+	Labels          map[string]string
+	ResourceControl portainer.ResourceControl
+}
+
+// HasAccessControl checks if a Docker resource has a Portainer access control
+func (r DockerResource) HasAccessControl() bool {
+	return r.ResourceControl.ID != 0
+}
+
+// dockerResourceListItem represents any Docker resource as returned by
+// Docker API list operations, decorated by Portainer. Field names are matched
+// case insensitively, so "Id" and "ID" are both decoded into the ID field.
+type dockerResourceListItem struct {
+	ID     string
+	Name   string
+	Names  []string
+	Labels map[string]string
+	Spec   struct {
+		Name   string
+		Labels map[string]string
+	}
+	portainerDecoratedDockerResource
+}
+
+// toDockerResource normalizes a listed Docker resource
+func (i dockerResourceListItem) toDockerResource(resourceType client.ResourceType) (resource DockerResource) {
+	resource = DockerResource{
+		ID:              i.ID,
+		Name:            i.Name,
+		Type:            resourceType,
+		Labels:          i.Labels,
+		ResourceControl: i.Portainer.ResourceControl,
+	}
+	if resource.Name == "" && i.Spec.Name != "" {
+		// Services, configs and secrets
+		resource.Name = i.Spec.Name
+		resource.Labels = i.Spec.Labels
+	}
+	if resource.Name == "" && len(i.Names) > 0 {
+		// Containers
+		resource.Name = strings.TrimPrefix(i.Names[0], "/")
+	}
+	if resource.ID == "" {
+		// Volumes are identified by their name
+		resource.ID = resource.Name
+	}
+	return
+}
+
+// dockerResourceListPath returns the Docker API path to list resources of a given type
+func dockerResourceListPath(resourceType client.ResourceType) string {
+	if resourceType == client.ResourceContainer {
+		return "containers/json"
+	}
+	return fmt.Sprintf("%ss", resourceType)
+}
+
+// GetDockerResources retrieves the Docker resources of a given type in an
+// endpoint, optionally filtered by labels (like "key" or "key=value")
+func GetDockerResources(endpointID portainer.EndpointID, resourceType client.ResourceType, labels ...string) (resources []DockerResource, err error) {
+	portainerClient, err := GetClient()
+	if err != nil {
+		return
+	}
+
+	query := url.Values{}
+	if resourceType == client.ResourceContainer {
+		query.Set("all", "1")
+	}
+	if len(labels) > 0 {
+		filtersJSONBytes, _ := json.Marshal(map[string][]string{
+			"label": labels,
+		})
+		query.Set("filters", string(filtersJSONBytes))
+	}
+
+	uri := fmt.Sprintf("endpoints/%d/docker/%s?%s", endpointID, dockerResourceListPath(resourceType), query.Encode())
+
+	var items []dockerResourceListItem
+	if resourceType == client.ResourceVolume {
+		// Volumes are wrapped in an object
+		var volumeList struct {
+			Volumes []dockerResourceListItem
+		}
+		err = portainerClient.DoJSONWithToken(uri, http.MethodGet, http.Header{}, nil, &volumeList)
+		items = volumeList.Volumes
+	} else {
+		err = portainerClient.DoJSONWithToken(uri, http.MethodGet, http.Header{}, nil, &items)
+	}
+	if err != nil {
+		return
+	}
+
+	for _, item := range items {
+		resources = append(resources, item.toDockerResource(resourceType))
+	}
+
+	return
+}
+
+// FindDockerResource finds a Docker resource in a list by id, name or id
+// prefix (in that order of precedence), failing if several resources match
+func FindDockerResource(resources []DockerResource, nameOrID string) (resource DockerResource, err error) {
+	for _, r := range resources {
+		if r.ID == nameOrID {
+			return r, nil
+		}
+	}
+
+	var matches []DockerResource
+	for _, r := range resources {
+		if r.Name == nameOrID {
+			matches = append(matches, r)
+		}
+	}
+	if len(matches) == 0 && nameOrID != "" {
+		for _, r := range resources {
+			if strings.HasPrefix(r.ID, nameOrID) {
+				matches = append(matches, r)
+			}
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		err = ErrDockerResourceNotFound
+	case 1:
+		resource = matches[0]
+	default:
+		var ids []string
+		for _, match := range matches {
+			ids = append(ids, match.ID)
+		}
+		err = fmt.Errorf("%s is ambiguous, it matches several resources: %s", nameOrID, strings.Join(ids, ", "))
+	}
+	return
+}
+
+// ResolveDockerResource retrieves a Docker resource in an endpoint by id,
+// name or id prefix
+func ResolveDockerResource(endpointID portainer.EndpointID, resourceType client.ResourceType, nameOrID string) (resource DockerResource, err error) {
+	resources, err := GetDockerResources(endpointID, resourceType)
+	if err != nil {
+		return
+	}
+
+	resource, err = FindDockerResource(resources, nameOrID)
+	if err == ErrDockerResourceNotFound {
+		err = fmt.Errorf("%s %s not found", resourceType, nameOrID)
+	}
+	return
+}
+
+// ResolveResource retrieves a stack (by name) or a Docker resource (by id,
+// name or id prefix) in an endpoint, decorated with its Portainer access control
+func ResolveResource(endpointID portainer.EndpointID, resourceType client.ResourceType, nameOrID string) (resource DockerResource, err error) {
+	if resourceType != client.ResourceStack {
+		return ResolveDockerResource(endpointID, resourceType, nameOrID)
+	}
+
+	stacks, err := GetStackResources(endpointID)
+	if err != nil {
+		return
+	}
+	for _, stack := range stacks {
+		if stack.Name == nameOrID {
+			return stack, nil
+		}
+	}
+	err = fmt.Errorf("stack %s not found", nameOrID)
+	return
+}
+
+// ParseResourceReference parses a resource reference like "stack/web" or
+// "service/web_api" into its type and name (or id)
+func ParseResourceReference(reference string) (resourceType client.ResourceType, nameOrID string, err error) {
+	parts := strings.SplitN(reference, "/", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		err = fmt.Errorf("invalid resource reference %q (must be like <type>/<name>)", reference)
+		return
+	}
+	resourceType = client.ResourceType(parts[0])
+	if !isAccessControlledResourceType(resourceType) {
+		err = fmt.Errorf("invalid resource type %q in resource reference %q", parts[0], reference)
+		return
+	}
+	nameOrID = parts[1]
+	return
+}
+
+// RemoveDockerResource removes a Docker resource from an endpoint
+func RemoveDockerResource(endpointID portainer.EndpointID, resourceType client.ResourceType, resourceID string) (err error) {
+	portainerClient, err := GetClient()
+	if err != nil {
+		return
+	}
+
+	err = portainerClient.DoJSONWithToken(fmt.Sprintf("endpoints/%d/docker/%ss/%s", endpointID, resourceType, url.PathEscape(resourceID)), http.MethodDelete, http.Header{}, nil, nil)
+	return
+}
+
+// GetStackNamespaceLabel returns the label used by Docker to identify the
+// resources belonging to a stack
+func GetStackNamespaceLabel(stack portainer.Stack) string {
+	if stack.Type == portainer.DockerComposeStack {
+		return fmt.Sprintf("%s=%s", ComposeStackNamespaceLabel, stack.Name)
+	}
+	return fmt.Sprintf("%s=%s", SwarmStackNamespaceLabel, stack.Name)
+}
+
+// GetStackDockerResources retrieves the Docker resources belonging to a
+// stack in an endpoint: the ones labelled with the stack namespace, and the
+// configs and secrets created from local files referenced by the stack file.
+// Services, configs and secrets are only retrieved for Swarm stacks.
+func GetStackDockerResources(endpointID portainer.EndpointID, stack portainer.Stack) (resources []DockerResource, err error) {
+	resourceTypes := []client.ResourceType{
+		client.ResourceService,
+		client.ResourceContainer,
+		client.ResourceVolume,
+		client.ResourceNetwork,
+		client.ResourceSecret,
+		client.ResourceConfig,
+	}
+	if stack.Type == portainer.DockerComposeStack {
+		resourceTypes = []client.ResourceType{
+			client.ResourceContainer,
+			client.ResourceVolume,
+			client.ResourceNetwork,
+		}
+	}
+
+	namespaceLabel := GetStackNamespaceLabel(stack)
+	for _, resourceType := range resourceTypes {
+		var typeResources []DockerResource
+		typeResources, err = GetDockerResources(endpointID, resourceType, namespaceLabel)
+		if err != nil {
+			return
+		}
+		resources = append(resources, typeResources...)
+		if resourceType == client.ResourceConfig || resourceType == client.ResourceSecret {
+			typeResources, err = GetDockerResources(endpointID, resourceType, fmt.Sprintf("%s=%s", StackFileSourceStackLabel, stack.Name))
+			if err != nil {
+				return
+			}
+			resources = append(resources, typeResources...)
+		}
+	}
+
+	return
+}
+
+// IsConflictError checks if an error is a Portainer API error with a 409 (Conflict) status code
+func IsConflictError(err error) bool {
+	genericError, isGenericError := err.(*client.GenericError)
+	return isGenericError && genericError.Code == http.StatusConflict
+}
+
+// UpdateDockerServiceLabels sets some labels on a Swarm service, keeping the
+// rest of its spec untouched
+func UpdateDockerServiceLabels(endpointID portainer.EndpointID, serviceName string, labels map[string]string) (err error) {
+	portainerClient, err := GetClient()
+	if err != nil {
+		return
+	}
+
+	// The spec is kept as a generic map so unknown fields are sent back as they are
+	var service struct {
+		ID      string
+		Version struct {
+			Index uint64
+		}
+		Spec map[string]interface{}
+	}
+	err = portainerClient.DoJSONWithToken(fmt.Sprintf("endpoints/%d/docker/services/%s", endpointID, url.PathEscape(serviceName)), http.MethodGet, http.Header{}, nil, &service)
+	if err != nil {
+		return
+	}
+
+	serviceLabels, _ := service.Spec["Labels"].(map[string]interface{})
+	if serviceLabels == nil {
+		serviceLabels = map[string]interface{}{}
+	}
+	for key, value := range labels {
+		serviceLabels[key] = value
+	}
+	service.Spec["Labels"] = serviceLabels
+
+	err = portainerClient.DoJSONWithToken(fmt.Sprintf("endpoints/%d/docker/services/%s/update?version=%d", endpointID, url.PathEscape(service.ID), service.Version.Index), http.MethodPost, http.Header{}, service.Spec, nil)
+	return
+}
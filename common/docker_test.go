@@ -0,0 +1,126 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/greenled/portainer-stack-utils/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindDockerResource(t *testing.T) {
+	resources := []DockerResource{
+		{ID: "abc123", Name: "web_app"},
+		{ID: "abd456", Name: "web_db"},
+		{ID: "def789", Name: "abc123x"},
+		{ID: "fed000", Name: "dup"},
+		{ID: "fed111", Name: "dup"},
+	}
+	tests := []struct {
+		name     string
+		nameOrID string
+		wantID   string
+		wantErr  bool
+	}{
+		{
+			name:     "by id",
+			nameOrID: "abc123",
+			wantID:   "abc123",
+		},
+		{
+			name:     "by name",
+			nameOrID: "web_db",
+			wantID:   "abd456",
+		},
+		{
+			name:     "names take precedence over id prefixes",
+			nameOrID: "abc123x",
+			wantID:   "def789",
+		},
+		{
+			name:     "by id prefix",
+			nameOrID: "de",
+			wantID:   "def789",
+		},
+		{
+			name:     "ambiguous id prefix",
+			nameOrID: "ab",
+			wantErr:  true,
+		},
+		{
+			name:     "ambiguous name",
+			nameOrID: "dup",
+			wantErr:  true,
+		},
+		{
+			name:     "not found",
+			nameOrID: "web_cache",
+			wantErr:  true,
+		},
+		{
+			name:     "empty",
+			nameOrID: "",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resource, err := FindDockerResource(resources, tt.nameOrID)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantID, resource.ID)
+			}
+		})
+	}
+}
+
+func TestParseResourceReference(t *testing.T) {
+	tests := []struct {
+		name         string
+		reference    string
+		wantType     client.ResourceType
+		wantNameOrID string
+		wantErr      bool
+	}{
+		{
+			name:         "stack",
+			reference:    "stack/web",
+			wantType:     client.ResourceStack,
+			wantNameOrID: "web",
+		},
+		{
+			name:         "names may contain slashes",
+			reference:    "volume/web/data",
+			wantType:     client.ResourceVolume,
+			wantNameOrID: "web/data",
+		},
+		{
+			name:      "missing name",
+			reference: "service/",
+			wantErr:   true,
+		},
+		{
+			name:      "missing type",
+			reference: "web_api",
+			wantErr:   true,
+		},
+		{
+			name:      "invalid type",
+			reference: "image/nginx",
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resourceType, nameOrID, err := ParseResourceReference(tt.reference)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantType, resourceType)
+				assert.Equal(t, tt.wantNameOrID, nameOrID)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"text/template"
+
+	portainer "github.com/portainer/portainer/api"
+)
+
+// Endpoint access entry types
+const (
+	EndpointAccessUser = "user"
+	EndpointAccessTeam = "team"
+)
+
+// EndpointAccessEntry represents a user or team authorized to access an
+// endpoint or endpoint group
+type EndpointAccessEntry struct {
+	// Type is one of user or team
+	Type string
+	// ID is the user or team id
+	ID int
+	// Name is the user or team name (or its id if it no longer exists)
+	Name string
+	// RoleID is the role granted to the user or team (0 if roles are not enabled)
+	RoleID portainer.RoleID
+}
+
+// ApplyToAccessPolicies returns the endpoint or endpoint group access
+// policies resulting of applying the changes to the existing ones. Users and
+// teams already authorized keep their policies, and new ones get a policy
+// without role.
+func (c AccessControlChanges) ApplyToAccessPolicies(userPolicies portainer.UserAccessPolicies, teamPolicies portainer.TeamAccessPolicies) (newUserPolicies portainer.UserAccessPolicies, newTeamPolicies portainer.TeamAccessPolicies) {
+	newUserPolicies = portainer.UserAccessPolicies{}
+	for userID, policy := range userPolicies {
+		if !containsUserID(c.RemoveUsers, userID) {
+			newUserPolicies[userID] = policy
+		}
+	}
+	for _, userID := range c.AddUsers {
+		if _, authorized := newUserPolicies[userID]; !authorized && !containsUserID(c.RemoveUsers, userID) {
+			newUserPolicies[userID] = portainer.AccessPolicy{}
+		}
+	}
+
+	newTeamPolicies = portainer.TeamAccessPolicies{}
+	for teamID, policy := range teamPolicies {
+		if !containsTeamID(c.RemoveTeams, teamID) {
+			newTeamPolicies[teamID] = policy
+		}
+	}
+	for _, teamID := range c.AddTeams {
+		if _, authorized := newTeamPolicies[teamID]; !authorized && !containsTeamID(c.RemoveTeams, teamID) {
+			newTeamPolicies[teamID] = portainer.AccessPolicy{}
+		}
+	}
+
+	return
+}
+
+// GetEndpointAccessEntries returns the users and teams authorized by some
+// endpoint or endpoint group access policies, resolving their names
+func GetEndpointAccessEntries(userPolicies portainer.UserAccessPolicies, teamPolicies portainer.TeamAccessPolicies) (entries []EndpointAccessEntry, err error) {
+	portainerClient, err := GetClient()
+	if err != nil {
+		return
+	}
+
+	if len(userPolicies) > 0 {
+		var users []portainer.User
+		users, err = portainerClient.UserList()
+		if err != nil {
+			return
+		}
+		userNames := map[portainer.UserID]string{}
+		for _, user := range users {
+			userNames[user.ID] = user.Username
+		}
+		for userID, policy := range userPolicies {
+			userName, exists := userNames[userID]
+			if !exists {
+				userName = fmt.Sprint(userID)
+			}
+			entries = append(entries, EndpointAccessEntry{
+				Type:   EndpointAccessUser,
+				ID:     int(userID),
+				Name:   userName,
+				RoleID: policy.RoleID,
+			})
+		}
+	}
+
+	if len(teamPolicies) > 0 {
+		var teams []portainer.Team
+		teams, err = portainerClient.TeamList()
+		if err != nil {
+			return
+		}
+		teamNames := map[portainer.TeamID]string{}
+		for _, team := range teams {
+			teamNames[team.ID] = team.Name
+		}
+		for teamID, policy := range teamPolicies {
+			teamName, exists := teamNames[teamID]
+			if !exists {
+				teamName = fmt.Sprint(teamID)
+			}
+			entries = append(entries, EndpointAccessEntry{
+				Type:   EndpointAccessTeam,
+				ID:     int(teamID),
+				Name:   teamName,
+				RoleID: policy.RoleID,
+			})
+		}
+	}
+
+	// Users first, then teams, sorted by name
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Type != entries[j].Type {
+			return entries[i].Type == EndpointAccessUser
+		}
+		return entries[i].Name < entries[j].Name
+	})
+
+	return
+}
+
+// PrintEndpointAccessEntries prints the users and teams authorized to access
+// an endpoint or endpoint group in a given format
+func PrintEndpointAccessEntries(entries []EndpointAccessEntry, format string) (err error) {
+	switch format {
+	case "table":
+		// Print entries in a table format
+		writer, err := NewTabWriter([]string{
+			"TYPE",
+			"ID",
+			"NAME",
+			"ROLE ID",
+		})
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			_, err = fmt.Fprintln(writer, fmt.Sprintf(
+				"%s\t%v\t%s\t%v",
+				e.Type,
+				e.ID,
+				e.Name,
+				e.RoleID,
+			))
+			if err != nil {
+				return err
+			}
+		}
+		return writer.Flush()
+	case "json":
+		// Print entries in a json format
+		entriesJSONBytes, err := json.Marshal(entries)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(entriesJSONBytes))
+	default:
+		// Print entries in a custom format
+		template, err := template.New("endpointAccessTpl").Parse(format)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			err = template.Execute(os.Stdout, e)
+			if err != nil {
+				return err
+			}
+			fmt.Println()
+		}
+	}
+	return
+}
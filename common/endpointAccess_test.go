@@ -0,0 +1,74 @@
+package common
+
+import (
+	"testing"
+
+	portainer "github.com/portainer/portainer/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessControlChanges_ApplyToAccessPolicies(t *testing.T) {
+	type args struct {
+		userPolicies portainer.UserAccessPolicies
+		teamPolicies portainer.TeamAccessPolicies
+	}
+	tests := []struct {
+		name             string
+		changes          AccessControlChanges
+		args             args
+		wantUserPolicies portainer.UserAccessPolicies
+		wantTeamPolicies portainer.TeamAccessPolicies
+	}{
+		{
+			name: "users and teams are authorized without policies",
+			changes: AccessControlChanges{
+				AddUsers: []portainer.UserID{2},
+				AddTeams: []portainer.TeamID{1},
+			},
+			wantUserPolicies: portainer.UserAccessPolicies{2: {}},
+			wantTeamPolicies: portainer.TeamAccessPolicies{1: {}},
+		},
+		{
+			name: "authorized users and teams keep their policies",
+			changes: AccessControlChanges{
+				AddUsers: []portainer.UserID{1, 3},
+				AddTeams: []portainer.TeamID{1},
+			},
+			args: args{
+				userPolicies: portainer.UserAccessPolicies{1: {RoleID: 2}},
+				teamPolicies: portainer.TeamAccessPolicies{1: {RoleID: 3}},
+			},
+			wantUserPolicies: portainer.UserAccessPolicies{1: {RoleID: 2}, 3: {}},
+			wantTeamPolicies: portainer.TeamAccessPolicies{1: {RoleID: 3}},
+		},
+		{
+			name: "users and teams are revoked",
+			changes: AccessControlChanges{
+				RemoveUsers: []portainer.UserID{1, 4},
+				RemoveTeams: []portainer.TeamID{1},
+			},
+			args: args{
+				userPolicies: portainer.UserAccessPolicies{1: {}, 2: {}},
+				teamPolicies: portainer.TeamAccessPolicies{1: {}},
+			},
+			wantUserPolicies: portainer.UserAccessPolicies{2: {}},
+			wantTeamPolicies: portainer.TeamAccessPolicies{},
+		},
+		{
+			name: "removals take precedence over additions",
+			changes: AccessControlChanges{
+				AddUsers:    []portainer.UserID{1},
+				RemoveUsers: []portainer.UserID{1},
+			},
+			wantUserPolicies: portainer.UserAccessPolicies{},
+			wantTeamPolicies: portainer.TeamAccessPolicies{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userPolicies, teamPolicies := tt.changes.ApplyToAccessPolicies(tt.args.userPolicies, tt.args.teamPolicies)
+			assert.Equal(t, tt.wantUserPolicies, userPolicies)
+			assert.Equal(t, tt.wantTeamPolicies, teamPolicies)
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package common
+
+import (
+	"fmt"
+	"sort"
+
+	portainer "github.com/portainer/portainer/api"
+)
+
+// Environment variables merge strategies
+const (
+	// EnvStrategyMerge adds new variables and updates the existing ones
+	EnvStrategyMerge = "merge"
+	// EnvStrategyReplace uses the new variables only
+	EnvStrategyReplace = "replace"
+	// EnvStrategyKeepExisting adds new variables without updating the existing ones
+	EnvStrategyKeepExisting = "keep-existing"
+	// EnvStrategyRemoveMissing adds new variables and removes the existing
+	// ones which are not among the new ones, without updating the rest
+	EnvStrategyRemoveMissing = "remove-missing"
+)
+
+// EnvStrategies lists the available environment variables merge strategies
+var EnvStrategies = []string{
+	EnvStrategyMerge,
+	EnvStrategyReplace,
+	EnvStrategyKeepExisting,
+	EnvStrategyRemoveMissing,
+}
+
+// EnvironmentVariablesChanges represents the names of the environment
+// variables added, changed and removed while merging them
+type EnvironmentVariablesChanges struct {
+	Added   []string
+	Changed []string
+	Removed []string
+}
+
+// IsEmpty checks if there are no environment variables changes
+func (c EnvironmentVariablesChanges) IsEmpty() bool {
+	return len(c.Added) == 0 && len(c.Changed) == 0 && len(c.Removed) == 0
+}
+
+// MergeEnvironmentVariables merges a set of new environment variables into
+// the current ones following a given strategy. Current variables keep their
+// order, and new ones are appended in the order they were given.
+func MergeEnvironmentVariables(current, new []portainer.Pair, strategy string) (merged []portainer.Pair, changes EnvironmentVariablesChanges, err error) {
+	newValues := map[string]string{}
+	for _, variable := range new {
+		newValues[variable.Name] = variable.Value
+	}
+	currentValues := map[string]string{}
+	for _, variable := range current {
+		currentValues[variable.Name] = variable.Value
+	}
+
+	var updateExisting, removeMissing bool
+	switch strategy {
+	case EnvStrategyMerge:
+		updateExisting = true
+	case EnvStrategyReplace:
+		updateExisting, removeMissing = true, true
+	case EnvStrategyKeepExisting:
+	case EnvStrategyRemoveMissing:
+		removeMissing = true
+	default:
+		err = fmt.Errorf("unknown environment variables merge strategy %q", strategy)
+		return
+	}
+
+	merged = []portainer.Pair{}
+	for _, variable := range current {
+		newValue, isNew := newValues[variable.Name]
+		switch {
+		case !isNew && removeMissing:
+			changes.Removed = append(changes.Removed, variable.Name)
+		case isNew && updateExisting && newValue != variable.Value:
+			changes.Changed = append(changes.Changed, variable.Name)
+			merged = append(merged, portainer.Pair{
+				Name:  variable.Name,
+				Value: newValue,
+			})
+		default:
+			merged = append(merged, variable)
+		}
+	}
+	for _, variable := range new {
+		if _, isCurrent := currentValues[variable.Name]; !isCurrent {
+			changes.Added = append(changes.Added, variable.Name)
+			merged = append(merged, variable)
+			// Avoid adding duplicated variables twice
+			currentValues[variable.Name] = variable.Value
+		}
+	}
+
+	sort.Strings(changes.Added)
+	sort.Strings(changes.Changed)
+	sort.Strings(changes.Removed)
+
+	return
+}
@@ -0,0 +1,145 @@
+package common
+
+import (
+	"testing"
+
+	portainer "github.com/portainer/portainer/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeEnvironmentVariables(t *testing.T) {
+	current := []portainer.Pair{
+		{Name: "KEPT", Value: "kept"},
+		{Name: "CHANGED", Value: "old"},
+		{Name: "MISSING", Value: "missing"},
+	}
+	new := []portainer.Pair{
+		{Name: "CHANGED", Value: "new"},
+		{Name: "KEPT", Value: "kept"},
+		{Name: "ADDED", Value: "added"},
+	}
+
+	type args struct {
+		current  []portainer.Pair
+		new      []portainer.Pair
+		strategy string
+	}
+	tests := []struct {
+		name        string
+		args        args
+		wantMerged  []portainer.Pair
+		wantChanges EnvironmentVariablesChanges
+		wantErr     bool
+	}{
+		{
+			name: "merge strategy adds new variables and updates existing ones",
+			args: args{
+				current:  current,
+				new:      new,
+				strategy: EnvStrategyMerge,
+			},
+			wantMerged: []portainer.Pair{
+				{Name: "KEPT", Value: "kept"},
+				{Name: "CHANGED", Value: "new"},
+				{Name: "MISSING", Value: "missing"},
+				{Name: "ADDED", Value: "added"},
+			},
+			wantChanges: EnvironmentVariablesChanges{
+				Added:   []string{"ADDED"},
+				Changed: []string{"CHANGED"},
+			},
+		},
+		{
+			name: "replace strategy uses new variables only",
+			args: args{
+				current:  current,
+				new:      new,
+				strategy: EnvStrategyReplace,
+			},
+			wantMerged: []portainer.Pair{
+				{Name: "KEPT", Value: "kept"},
+				{Name: "CHANGED", Value: "new"},
+				{Name: "ADDED", Value: "added"},
+			},
+			wantChanges: EnvironmentVariablesChanges{
+				Added:   []string{"ADDED"},
+				Changed: []string{"CHANGED"},
+				Removed: []string{"MISSING"},
+			},
+		},
+		{
+			name: "keep-existing strategy adds new variables only",
+			args: args{
+				current:  current,
+				new:      new,
+				strategy: EnvStrategyKeepExisting,
+			},
+			wantMerged: []portainer.Pair{
+				{Name: "KEPT", Value: "kept"},
+				{Name: "CHANGED", Value: "old"},
+				{Name: "MISSING", Value: "missing"},
+				{Name: "ADDED", Value: "added"},
+			},
+			wantChanges: EnvironmentVariablesChanges{
+				Added: []string{"ADDED"},
+			},
+		},
+		{
+			name: "remove-missing strategy adds new variables and removes missing ones",
+			args: args{
+				current:  current,
+				new:      new,
+				strategy: EnvStrategyRemoveMissing,
+			},
+			wantMerged: []portainer.Pair{
+				{Name: "KEPT", Value: "kept"},
+				{Name: "CHANGED", Value: "old"},
+				{Name: "ADDED", Value: "added"},
+			},
+			wantChanges: EnvironmentVariablesChanges{
+				Added:   []string{"ADDED"},
+				Removed: []string{"MISSING"},
+			},
+		},
+		{
+			name: "merging into no variables adds all of them",
+			args: args{
+				new:      new,
+				strategy: EnvStrategyMerge,
+			},
+			wantMerged: new,
+			wantChanges: EnvironmentVariablesChanges{
+				Added: []string{"ADDED", "CHANGED", "KEPT"},
+			},
+		},
+		{
+			name: "merging no variables changes nothing",
+			args: args{
+				current:  current,
+				strategy: EnvStrategyMerge,
+			},
+			wantMerged: current,
+		},
+		{
+			name: "unknown strategy fails",
+			args: args{
+				current:  current,
+				new:      new,
+				strategy: "wololo",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotMerged, gotChanges, err := MergeEnvironmentVariables(tt.args.current, tt.args.new, tt.args.strategy)
+			assert.Equal(t, tt.wantErr, err != nil)
+			if tt.wantErr {
+				return
+			}
+			assert.Equal(t, tt.wantMerged, gotMerged)
+			assert.Equal(t, tt.wantChanges, gotChanges)
+			assert.Equal(t, tt.wantChanges.IsEmpty(), gotChanges.IsEmpty())
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// RunHooks runs a list of shell commands one after another, with the given
+// environment variables added to the current environment. It stops at the
+// first command which fails.
+func RunHooks(hooks []string, environmentVariables map[string]string) error {
+	var environment []string
+	for name, value := range environmentVariables {
+		environment = append(environment, fmt.Sprintf("%s=%s", name, value))
+	}
+	sort.Strings(environment)
+
+	for _, hook := range hooks {
+		var hookCmd *exec.Cmd
+		if runtime.GOOS == "windows" {
+			hookCmd = exec.Command("cmd", "/C", hook)
+		} else {
+			hookCmd = exec.Command("sh", "-c", hook)
+		}
+		hookCmd.Env = append(os.Environ(), environment...)
+		hookCmd.Stdin = os.Stdin
+		hookCmd.Stdout = os.Stdout
+		hookCmd.Stderr = os.Stderr
+
+		logrus.WithFields(logrus.Fields{
+			"hook": hook,
+		}).Debug("Running hook")
+		err := hookCmd.Run()
+		if err != nil {
+			return fmt.Errorf("hook %q failed: %s", hook, err)
+		}
+	}
+
+	return nil
+}
+
+// GetStackDeployHooks returns the hooks of a deployment stage set for a stack
+// in the settings file, under the "stack.deploy.hooks" map. The map is looked
+// up by the exact stack name instead of building a nested key, as stack names
+// may contain dots, which viper takes as key separators.
+func GetStackDeployHooks(stackName, stage string) []string {
+	stacksHooks := viper.GetStringMap("stack.deploy.hooks")
+	stackHooks, ok := stacksHooks[stackName]
+	if !ok {
+		// viper lowercases settings keys
+		stackHooks = stacksHooks[strings.ToLower(stackName)]
+	}
+	switch hooks := cast.ToStringMap(stackHooks)[stage].(type) {
+	case nil:
+		return nil
+	case string:
+		// A single hook is not split, as hook commands contain spaces
+		return []string{hooks}
+	default:
+		return cast.ToStringSlice(hooks)
+	}
+}
@@ -0,0 +1,74 @@
+package common
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetStackDeployHooks(t *testing.T) {
+	viper.SetConfigType("yaml")
+	err := viper.ReadConfig(bytes.NewBufferString(`stack:
+  deploy:
+    hooks:
+      web:
+        pre-deploy:
+          - ./backup.sh
+      web.production:
+        pre-deploy:
+          - ./backup.sh production
+        post-deploy: ./smoke-test.sh production
+`))
+	assert.Nil(t, err)
+	defer viper.Reset()
+
+	type args struct {
+		stackName string
+		stage     string
+	}
+	tests := []struct {
+		name string
+		args args
+		want []string
+	}{
+		{
+			name: "hooks are returned by stack name",
+			args: args{
+				stackName: "web",
+				stage:     "pre-deploy",
+			},
+			want: []string{"./backup.sh"},
+		},
+		{
+			name: "hooks of stacks with dots in their names are returned",
+			args: args{
+				stackName: "web.production",
+				stage:     "pre-deploy",
+			},
+			want: []string{"./backup.sh production"},
+		},
+		{
+			name: "single hooks are returned as a list",
+			args: args{
+				stackName: "web.production",
+				stage:     "post-deploy",
+			},
+			want: []string{"./smoke-test.sh production"},
+		},
+		{
+			name: "hooks of other stacks are not returned",
+			args: args{
+				stackName: "web.staging",
+				stage:     "pre-deploy",
+			},
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, GetStackDeployHooks(tt.args.stackName, tt.args.stage))
+		})
+	}
+}
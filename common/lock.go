@@ -0,0 +1,300 @@
+package common
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/greenled/portainer-stack-utils/client"
+	portainer "github.com/portainer/portainer/api"
+	"github.com/sirupsen/logrus"
+)
+
+// Lock errors
+const (
+	ErrStackLocked       = Error("Stack locked")
+	ErrStackLockNotFound = Error("Stack lock not found")
+	ErrStackLockNotOwned = Error("Stack lock not owned")
+)
+
+const stackLockRetryInterval = 2 * time.Second
+
+// StackLockUnreadableError is returned when a stack is locked, but its lock
+// details can not be read from the Docker resource storing it (like when its
+// labels were edited or removed by hand)
+type StackLockUnreadableError struct {
+	Stack    string
+	Resource string
+	Err      error
+}
+
+// Error returns the error message.
+func (e *StackLockUnreadableError) Error() string {
+	return fmt.Sprintf("stack %s is locked, but its lock %s can not be read (%s), so it will never expire; remove it with: psu stack unlock %s --force", e.Stack, e.Resource, e.Err, e.Stack)
+}
+
+// Docker labels used to store stack lock details
+const (
+	stackLockIDLabel         = "io.github.greenled.portainer-stack-utils.lock.id"
+	stackLockStackLabel      = "io.github.greenled.portainer-stack-utils.lock.stack"
+	stackLockOwnerLabel      = "io.github.greenled.portainer-stack-utils.lock.owner"
+	stackLockAcquiredAtLabel = "io.github.greenled.portainer-stack-utils.lock.acquired-at"
+	stackLockTTLLabel        = "io.github.greenled.portainer-stack-utils.lock.ttl"
+)
+
+// StackLock represents an advisory lock on a stack. Locks are stored in the
+// endpoint as Docker configs (in Swarm endpoints) or volumes (otherwise),
+// as creating them is an atomic operation in the Docker daemon.
+type StackLock struct {
+	Stack      string
+	Owner      string
+	AcquiredAt time.Time
+	TTL        time.Duration
+	id         string
+	endpointID portainer.EndpointID
+	swarm      bool
+}
+
+// IsExpired checks if a stack lock's TTL has been exceeded
+func (l StackLock) IsExpired() bool {
+	return time.Now().After(l.AcquiredAt.Add(l.TTL))
+}
+
+// resourceType returns the type of Docker resource used to store the lock
+func (l StackLock) resourceType() client.ResourceType {
+	if l.swarm {
+		return client.ResourceConfig
+	}
+	return client.ResourceVolume
+}
+
+// GetDefaultStackLockOwner returns a stack lock owner identifying the current user and host
+func GetDefaultStackLockOwner() string {
+	portainerClient, err := GetClient()
+	if err != nil {
+		return ""
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return portainerClient.GetUsername()
+	}
+	return fmt.Sprintf("%s@%s", portainerClient.GetUsername(), hostname)
+}
+
+// getStackLockName returns the name of the Docker resource used to store a stack lock
+func getStackLockName(stackName string) string {
+	return fmt.Sprintf("psu-lock-%s", stackName)
+}
+
+// GetStackLock retrieves the current lock of a stack (if any)
+func GetStackLock(endpointID portainer.EndpointID, swarm bool, stackName string) (lock StackLock, err error) {
+	portainerClient, err := GetClient()
+	if err != nil {
+		return
+	}
+
+	lock = StackLock{
+		Stack:      stackName,
+		endpointID: endpointID,
+		swarm:      swarm,
+	}
+
+	var item dockerResourceListItem
+	err = portainerClient.DoJSONWithToken(fmt.Sprintf("endpoints/%d/docker/%ss/%s", endpointID, lock.resourceType(), url.PathEscape(getStackLockName(stackName))), http.MethodGet, http.Header{}, nil, &item)
+	if genericError, isGenericError := err.(*client.GenericError); isGenericError && genericError.Code == http.StatusNotFound {
+		err = ErrStackLockNotFound
+		return
+	} else if err != nil {
+		return
+	}
+
+	err = lock.readLabels(item.toDockerResource(lock.resourceType()).Labels)
+	return
+}
+
+// readLabels fills a stack lock's details from its Docker resource labels.
+// A *StackLockUnreadableError is returned if they are missing or invalid.
+func (l *StackLock) readLabels(labels map[string]string) (err error) {
+	l.id = labels[stackLockIDLabel]
+	l.Owner = labels[stackLockOwnerLabel]
+	l.AcquiredAt, err = time.Parse(time.RFC3339, labels[stackLockAcquiredAtLabel])
+	if err != nil {
+		return l.unreadableError(stackLockAcquiredAtLabel, err)
+	}
+	l.TTL, err = time.ParseDuration(labels[stackLockTTLLabel])
+	if err != nil {
+		return l.unreadableError(stackLockTTLLabel, err)
+	}
+	return
+}
+
+// unreadableError returns the error for a stack lock with an invalid label
+func (l StackLock) unreadableError(label string, err error) error {
+	return &StackLockUnreadableError{
+		Stack:    l.Stack,
+		Resource: fmt.Sprintf("%s %s", l.resourceType(), getStackLockName(l.Stack)),
+		Err:      fmt.Errorf("invalid %s label: %s", label, err),
+	}
+}
+
+// AcquireStackLock acquires a lock on a stack, waiting up to a given timeout
+// for the current lock (if any) to be released or expire
+func AcquireStackLock(endpointID portainer.EndpointID, swarm bool, stackName, owner string, ttl, timeout time.Duration) (lock StackLock, err error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		lock, err = tryAcquireStackLock(endpointID, swarm, stackName, owner, ttl)
+		if err == ErrStackLockNotFound {
+			// The lock was released right before being inspected
+			logrus.WithFields(logrus.Fields{
+				"stack": stackName,
+			}).Debug("Stack lock released while acquiring it")
+		} else if err != ErrStackLocked {
+			return
+		} else if lock.IsExpired() {
+			logrus.WithFields(logrus.Fields{
+				"stack":       stackName,
+				"owner":       lock.Owner,
+				"acquired-at": lock.AcquiredAt,
+			}).Warning("Removing expired stack lock")
+			removalErr := lock.removeIfCurrent(true)
+			if removalErr != nil && removalErr != ErrStackLockNotFound && removalErr != ErrStackLockNotOwned {
+				err = removalErr
+				return
+			}
+			// If the lock was taken over by someone else we go back to waiting
+		} else {
+			logrus.WithFields(logrus.Fields{
+				"stack":       stackName,
+				"owner":       lock.Owner,
+				"acquired-at": lock.AcquiredAt,
+			}).Info("Waiting for stack lock to be released")
+		}
+
+		if time.Now().After(deadline) {
+			err = ErrStackLocked
+			return
+		}
+		time.Sleep(stackLockRetryInterval)
+	}
+}
+
+// tryAcquireStackLock makes a single attempt to acquire a stack lock. If the
+// stack is already locked, the current lock is returned along with ErrStackLocked.
+func tryAcquireStackLock(endpointID portainer.EndpointID, swarm bool, stackName, owner string, ttl time.Duration) (lock StackLock, err error) {
+	portainerClient, err := GetClient()
+	if err != nil {
+		return
+	}
+
+	lock = StackLock{
+		Stack:      stackName,
+		Owner:      owner,
+		AcquiredAt: time.Now().UTC().Truncate(time.Second),
+		TTL:        ttl,
+		endpointID: endpointID,
+		swarm:      swarm,
+	}
+	lockIDBytes := make([]byte, 16)
+	_, err = rand.Read(lockIDBytes)
+	if err != nil {
+		return
+	}
+	lock.id = hex.EncodeToString(lockIDBytes)
+	labels := map[string]string{
+		stackLockIDLabel:         lock.id,
+		stackLockStackLabel:      stackName,
+		stackLockOwnerLabel:      owner,
+		stackLockAcquiredAtLabel: lock.AcquiredAt.Format(time.RFC3339),
+		stackLockTTLLabel:        ttl.String(),
+	}
+
+	if swarm {
+		// Creating a config fails if another one with the same name exists
+		err = portainerClient.DoJSONWithToken(fmt.Sprintf("endpoints/%d/docker/configs/create", endpointID), http.MethodPost, http.Header{}, map[string]interface{}{
+			"Name":   getStackLockName(stackName),
+			"Labels": labels,
+			"Data":   base64.StdEncoding.EncodeToString([]byte(owner)),
+		}, nil)
+		if IsConflictError(err) {
+			lock, err = GetStackLock(endpointID, swarm, stackName)
+			if err == nil {
+				err = ErrStackLocked
+			}
+		}
+		return
+	}
+
+	// Creating a volume returns the existing one if there is another one
+	// with the same name, so its labels tell who owns the lock
+	var item dockerResourceListItem
+	err = portainerClient.DoJSONWithToken(fmt.Sprintf("endpoints/%d/docker/volumes/create", endpointID), http.MethodPost, http.Header{}, map[string]interface{}{
+		"Name":   getStackLockName(stackName),
+		"Labels": labels,
+	}, &item)
+	if err != nil {
+		return
+	}
+	createdLabels := item.toDockerResource(client.ResourceVolume).Labels
+	if createdLabels[stackLockIDLabel] != lock.id {
+		err = lock.readLabels(createdLabels)
+		if err == nil {
+			err = ErrStackLocked
+		}
+	}
+	return
+}
+
+// Release releases a stack lock, as long as it has not been taken over by
+// someone else (i.e. after expiring)
+func (l StackLock) Release() (err error) {
+	return l.removeIfCurrent(false)
+}
+
+// removeIfCurrent removes a stack lock as long as it is still the current
+// one (it has not been taken over by someone else), and optionally it is
+// still expired
+func (l StackLock) removeIfCurrent(expired bool) (err error) {
+	currentLock, err := GetStackLock(l.endpointID, l.swarm, l.Stack)
+	if err != nil {
+		return
+	}
+
+	if currentLock.id != l.id || (expired && !currentLock.IsExpired()) {
+		err = ErrStackLockNotOwned
+		return
+	}
+
+	return removeStackLock(currentLock)
+}
+
+// UnlockStack removes a stack's lock, as long as it is owned by the given
+// owner or force is set. Unreadable locks are only removed if force is set.
+func UnlockStack(endpointID portainer.EndpointID, swarm bool, stackName, owner string, force bool) (err error) {
+	lock, err := GetStackLock(endpointID, swarm, stackName)
+	if _, isUnreadable := err.(*StackLockUnreadableError); isUnreadable && force {
+		return removeStackLock(lock)
+	} else if err != nil {
+		return
+	}
+
+	if !force && lock.Owner != owner {
+		err = ErrStackLockNotOwned
+		return
+	}
+
+	return removeStackLock(lock)
+}
+
+// removeStackLock removes the Docker resource storing a stack lock
+func removeStackLock(lock StackLock) (err error) {
+	err = RemoveDockerResource(lock.endpointID, lock.resourceType(), getStackLockName(lock.Stack))
+	if genericError, isGenericError := err.(*client.GenericError); isGenericError && genericError.Code == http.StatusNotFound {
+		err = ErrStackLockNotFound
+	}
+	return
+}
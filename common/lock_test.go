@@ -0,0 +1,274 @@
+package common
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/greenled/portainer-stack-utils/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStackLock_readLabels(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		want    StackLock
+		wantErr bool
+	}{
+		{
+			name: "valid labels",
+			labels: map[string]string{
+				stackLockIDLabel:         "abc",
+				stackLockOwnerLabel:      "admin@ci",
+				stackLockAcquiredAtLabel: "2019-10-01T10:00:00Z",
+				stackLockTTLLabel:        "15m0s",
+			},
+			want: StackLock{
+				Stack:      "web",
+				Owner:      "admin@ci",
+				AcquiredAt: time.Date(2019, 10, 1, 10, 0, 0, 0, time.UTC),
+				TTL:        15 * time.Minute,
+				id:         "abc",
+			},
+		},
+		{
+			name: "invalid acquisition time",
+			labels: map[string]string{
+				stackLockIDLabel:         "abc",
+				stackLockAcquiredAtLabel: "yesterday",
+				stackLockTTLLabel:        "15m0s",
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid TTL",
+			labels: map[string]string{
+				stackLockIDLabel:         "abc",
+				stackLockAcquiredAtLabel: "2019-10-01T10:00:00Z",
+				stackLockTTLLabel:        "forever",
+			},
+			wantErr: true,
+		},
+		{
+			name:    "missing labels",
+			labels:  map[string]string{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lock := StackLock{Stack: "web"}
+			err := lock.readLabels(tt.labels)
+			if tt.wantErr {
+				assert.IsType(t, &StackLockUnreadableError{}, err)
+				assert.Contains(t, err.Error(), "volume psu-lock-web")
+				assert.Contains(t, err.Error(), "psu stack unlock web --force")
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, lock)
+			}
+		})
+	}
+}
+
+func TestStackLock_IsExpired(t *testing.T) {
+	tests := []struct {
+		name string
+		lock StackLock
+		want bool
+	}{
+		{
+			name: "lock within its TTL",
+			lock: StackLock{AcquiredAt: time.Now().Add(-time.Minute), TTL: time.Hour},
+			want: false,
+		},
+		{
+			name: "lock past its TTL",
+			lock: StackLock{AcquiredAt: time.Now().Add(-time.Hour), TTL: time.Minute},
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.lock.IsExpired())
+		})
+	}
+}
+
+func TestStackLock_Release(t *testing.T) {
+	activeLabels := map[string]string{
+		stackLockIDLabel:         "abc",
+		stackLockAcquiredAtLabel: time.Now().UTC().Format(time.RFC3339),
+		stackLockTTLLabel:        "1h0m0s",
+	}
+	expiredLabels := map[string]string{
+		stackLockIDLabel:         "abc",
+		stackLockAcquiredAtLabel: time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339),
+		stackLockTTLLabel:        "1h0m0s",
+	}
+	tests := []struct {
+		name          string
+		lockID        string
+		expired       bool
+		currentLabels map[string]string
+		wantErr       error
+		wantRemoved   bool
+	}{
+		{
+			name:          "owned lock is released",
+			lockID:        "abc",
+			currentLabels: activeLabels,
+			wantRemoved:   true,
+		},
+		{
+			name:          "lock taken over by someone else is not released",
+			lockID:        "def",
+			currentLabels: activeLabels,
+			wantErr:       ErrStackLockNotOwned,
+		},
+		{
+			name:          "already released lock",
+			lockID:        "abc",
+			currentLabels: nil,
+			wantErr:       ErrStackLockNotFound,
+		},
+		{
+			name:          "expired lock is removed",
+			lockID:        "abc",
+			expired:       true,
+			currentLabels: expiredLabels,
+			wantRemoved:   true,
+		},
+		{
+			name:          "expired lock replaced by someone else is not removed",
+			lockID:        "def",
+			expired:       true,
+			currentLabels: expiredLabels,
+			wantErr:       ErrStackLockNotOwned,
+		},
+		{
+			name:          "lock no longer expired is not removed",
+			lockID:        "abc",
+			expired:       true,
+			currentLabels: activeLabels,
+			wantErr:       ErrStackLockNotOwned,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			removed := false
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if req.URL.Path != "/api/endpoints/1/docker/volumes/psu-lock-web" || tt.currentLabels == nil {
+					w.WriteHeader(http.StatusNotFound)
+					w.Write([]byte(`{"message":"not found"}`))
+					return
+				}
+				switch req.Method {
+				case http.MethodGet:
+					json.NewEncoder(w).Encode(map[string]interface{}{
+						"Name":   "psu-lock-web",
+						"Labels": tt.currentLabels,
+					})
+				case http.MethodDelete:
+					removed = true
+					w.WriteHeader(http.StatusNoContent)
+				}
+			}))
+			defer ts.Close()
+
+			apiURL, _ := url.Parse(ts.URL + "/api/")
+			cachedClient = client.NewClient(ts.Client(), client.Config{URL: apiURL, Token: "token"})
+			defer func() { cachedClient = nil }()
+
+			lock := StackLock{Stack: "web", id: tt.lockID, endpointID: 1}
+			var err error
+			if tt.expired {
+				err = lock.removeIfCurrent(true)
+			} else {
+				err = lock.Release()
+			}
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.wantRemoved, removed)
+		})
+	}
+}
+
+func TestUnlockStack(t *testing.T) {
+	unreadableLabels := map[string]string{
+		stackLockIDLabel:    "abc",
+		stackLockOwnerLabel: "admin@ci",
+		stackLockTTLLabel:   "1h0m0s",
+	}
+	tests := []struct {
+		name           string
+		owner          string
+		force          bool
+		currentLabels  map[string]string
+		wantUnreadable bool
+		wantRemoved    bool
+	}{
+		{
+			name:  "owned lock is removed",
+			owner: "admin@ci",
+			currentLabels: map[string]string{
+				stackLockIDLabel:         "abc",
+				stackLockOwnerLabel:      "admin@ci",
+				stackLockAcquiredAtLabel: time.Now().UTC().Format(time.RFC3339),
+				stackLockTTLLabel:        "1h0m0s",
+			},
+			wantRemoved: true,
+		},
+		{
+			name:           "unreadable lock is not removed without force",
+			owner:          "admin@ci",
+			currentLabels:  unreadableLabels,
+			wantUnreadable: true,
+		},
+		{
+			name:          "unreadable lock is removed with force",
+			owner:         "someone@else",
+			force:         true,
+			currentLabels: unreadableLabels,
+			wantRemoved:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			removed := false
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if req.URL.Path != "/api/endpoints/1/docker/volumes/psu-lock-web" {
+					w.WriteHeader(http.StatusNotFound)
+					w.Write([]byte(`{"message":"not found"}`))
+					return
+				}
+				switch req.Method {
+				case http.MethodGet:
+					json.NewEncoder(w).Encode(map[string]interface{}{
+						"Name":   "psu-lock-web",
+						"Labels": tt.currentLabels,
+					})
+				case http.MethodDelete:
+					removed = true
+					w.WriteHeader(http.StatusNoContent)
+				}
+			}))
+			defer ts.Close()
+
+			apiURL, _ := url.Parse(ts.URL + "/api/")
+			cachedClient = client.NewClient(ts.Client(), client.Config{URL: apiURL, Token: "token"})
+			defer func() { cachedClient = nil }()
+
+			err := UnlockStack(1, false, "web", tt.owner, tt.force)
+			if tt.wantUnreadable {
+				assert.IsType(t, &StackLockUnreadableError{}, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantRemoved, removed)
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/greenled/portainer-stack-utils/version"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Notification payload formats
+const (
+	// NotificationFormatJSON posts the notification as plain JSON
+	NotificationFormatJSON = "json"
+	// NotificationFormatSlack posts a Slack incoming webhook message
+	NotificationFormatSlack = "slack"
+	// NotificationFormatTeams posts a Microsoft Teams connector card
+	NotificationFormatTeams = "teams"
+)
+
+// NotificationFormats lists the available notification payload formats
+var NotificationFormats = []string{
+	NotificationFormatJSON,
+	NotificationFormatSlack,
+	NotificationFormatTeams,
+}
+
+// Notification actions
+const (
+	NotificationActionDeploy   = "deploy"
+	NotificationActionRemove   = "remove"
+	NotificationActionRollback = "rollback"
+)
+
+// Notification results
+const (
+	NotificationResultSuccess = "success"
+	NotificationResultFailure = "failure"
+)
+
+// Notification represents the outcome of an action on a stack
+type Notification struct {
+	Stack    string        `json:"stack"`
+	Endpoint string        `json:"endpoint"`
+	Action   string        `json:"action"`
+	User     string        `json:"user"`
+	Duration time.Duration `json:"-"`
+	Result   string        `json:"result"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// MarshalJSON encodes a notification, with its duration in human readable
+// form (like 1m30s) and in seconds
+func (n Notification) MarshalJSON() ([]byte, error) {
+	type notification Notification
+	return json.Marshal(struct {
+		notification
+		Duration        string  `json:"duration"`
+		DurationSeconds float64 `json:"duration_seconds"`
+	}{
+		notification:    notification(n),
+		Duration:        n.Duration.String(),
+		DurationSeconds: n.Duration.Seconds(),
+	})
+}
+
+// NewNotification creates a notification for an action on a stack which
+// started at a given time, and failed if err is not nil
+func NewNotification(action, stackName, endpointName string, startedAt time.Time, err error) (n Notification) {
+	n = Notification{
+		Stack:    stackName,
+		Endpoint: endpointName,
+		Action:   action,
+		Duration: time.Since(startedAt).Round(time.Millisecond),
+		Result:   NotificationResultSuccess,
+	}
+	if portainerClient, clientRetrievalErr := GetClient(); clientRetrievalErr == nil {
+		n.User = portainerClient.GetUsername()
+	}
+	if err != nil {
+		n.Result = NotificationResultFailure
+		n.Error = err.Error()
+	}
+	return
+}
+
+// summary returns a one-line, human readable description of a notification
+func (n Notification) summary() string {
+	if n.Result == NotificationResultSuccess {
+		return fmt.Sprintf("Stack %s %s succeeded on endpoint %s", n.Stack, n.Action, n.Endpoint)
+	}
+	return fmt.Sprintf("Stack %s %s failed on endpoint %s", n.Stack, n.Action, n.Endpoint)
+}
+
+// facts returns the notification details as ordered name/value pairs
+func (n Notification) facts() (facts [][2]string) {
+	facts = [][2]string{
+		{"Stack", n.Stack},
+		{"Endpoint", n.Endpoint},
+		{"Action", n.Action},
+		{"User", n.User},
+		{"Duration", n.Duration.String()},
+		{"Result", n.Result},
+	}
+	if n.Error != "" {
+		facts = append(facts, [2]string{"Error", n.Error})
+	}
+	return
+}
+
+// GetNotificationPayload returns the payload to post for a notification in a given format
+func GetNotificationPayload(n Notification, format string) (payload interface{}, err error) {
+	switch format {
+	case NotificationFormatJSON:
+		payload = n
+	case NotificationFormatSlack:
+		color := "good"
+		if n.Result != NotificationResultSuccess {
+			color = "danger"
+		}
+		var fields []map[string]interface{}
+		for _, fact := range n.facts() {
+			fields = append(fields, map[string]interface{}{
+				"title": fact[0],
+				"value": fact[1],
+				"short": fact[0] != "Error",
+			})
+		}
+		payload = map[string]interface{}{
+			"text": n.summary(),
+			"attachments": []map[string]interface{}{
+				{
+					"color":    color,
+					"fallback": n.summary(),
+					"fields":   fields,
+				},
+			},
+		}
+	case NotificationFormatTeams:
+		color := "2EB886"
+		if n.Result != NotificationResultSuccess {
+			color = "A30200"
+		}
+		var facts []map[string]string
+		for _, fact := range n.facts() {
+			facts = append(facts, map[string]string{
+				"name":  fact[0],
+				"value": fact[1],
+			})
+		}
+		payload = map[string]interface{}{
+			"@type":      "MessageCard",
+			"@context":   "https://schema.org/extensions",
+			"summary":    n.summary(),
+			"title":      n.summary(),
+			"themeColor": color,
+			"sections": []map[string]interface{}{
+				{
+					"facts": facts,
+				},
+			},
+		}
+	default:
+		err = fmt.Errorf("unknown notification format %q", format)
+	}
+	return
+}
+
+// SendNotification posts a notification to a webhook URL in a given format
+func SendNotification(httpClient *http.Client, webhookURL, format string, n Notification) (err error) {
+	payload, err := GetNotificationPayload(n, format)
+	if err != nil {
+		return
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", version.BuildUseAgentString())
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		err = fmt.Errorf("webhook responded with status %s", resp.Status)
+	}
+	return
+}
+
+// Notify posts a notification to the webhooks set in the "notify-webhook"
+// setting. Failures are logged as warnings, so notifications never make the
+// notified action fail.
+func Notify(n Notification) {
+	webhooks := viper.GetStringSlice("notify-webhook")
+	if len(webhooks) == 0 {
+		return
+	}
+
+	httpClient := &http.Client{
+		Timeout: viper.GetDuration("notify-timeout"),
+	}
+	for _, webhook := range webhooks {
+		logrus.WithFields(logrus.Fields{
+			"stack":  n.Stack,
+			"action": n.Action,
+			"result": n.Result,
+		}).Debug("Sending notification")
+		err := SendNotification(httpClient, webhook, viper.GetString("notify-format"), n)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"stack":        n.Stack,
+				"message":      err.Error(),
+				"implications": "The webhook was not notified",
+			}).Warning("Notification failed")
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendNotification(t *testing.T) {
+	notification := Notification{
+		Stack:    "mystack",
+		Endpoint: "primary",
+		Action:   NotificationActionDeploy,
+		User:     "admin",
+		Duration: 1500 * time.Millisecond,
+		Result:   NotificationResultFailure,
+		Error:    "something went wrong",
+	}
+
+	type args struct {
+		format     string
+		statusCode int
+	}
+	tests := []struct {
+		name        string
+		args        args
+		wantPayload map[string]interface{}
+		wantErr     bool
+	}{
+		{
+			name: "json format posts the notification fields",
+			args: args{
+				format:     NotificationFormatJSON,
+				statusCode: http.StatusOK,
+			},
+			wantPayload: map[string]interface{}{
+				"stack":            "mystack",
+				"endpoint":         "primary",
+				"action":           "deploy",
+				"user":             "admin",
+				"duration":         "1.5s",
+				"duration_seconds": 1.5,
+				"result":           "failure",
+				"error":            "something went wrong",
+			},
+		},
+		{
+			name: "slack format posts a message with an attachment",
+			args: args{
+				format:     NotificationFormatSlack,
+				statusCode: http.StatusOK,
+			},
+			wantPayload: map[string]interface{}{
+				"text": "Stack mystack deploy failed on endpoint primary",
+				"attachments": []interface{}{
+					map[string]interface{}{
+						"color":    "danger",
+						"fallback": "Stack mystack deploy failed on endpoint primary",
+						"fields": []interface{}{
+							map[string]interface{}{"title": "Stack", "value": "mystack", "short": true},
+							map[string]interface{}{"title": "Endpoint", "value": "primary", "short": true},
+							map[string]interface{}{"title": "Action", "value": "deploy", "short": true},
+							map[string]interface{}{"title": "User", "value": "admin", "short": true},
+							map[string]interface{}{"title": "Duration", "value": "1.5s", "short": true},
+							map[string]interface{}{"title": "Result", "value": "failure", "short": true},
+							map[string]interface{}{"title": "Error", "value": "something went wrong", "short": false},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "teams format posts a message card",
+			args: args{
+				format:     NotificationFormatTeams,
+				statusCode: http.StatusOK,
+			},
+			wantPayload: map[string]interface{}{
+				"@type":      "MessageCard",
+				"@context":   "https://schema.org/extensions",
+				"summary":    "Stack mystack deploy failed on endpoint primary",
+				"title":      "Stack mystack deploy failed on endpoint primary",
+				"themeColor": "A30200",
+				"sections": []interface{}{
+					map[string]interface{}{
+						"facts": []interface{}{
+							map[string]interface{}{"name": "Stack", "value": "mystack"},
+							map[string]interface{}{"name": "Endpoint", "value": "primary"},
+							map[string]interface{}{"name": "Action", "value": "deploy"},
+							map[string]interface{}{"name": "User", "value": "admin"},
+							map[string]interface{}{"name": "Duration", "value": "1.5s"},
+							map[string]interface{}{"name": "Result", "value": "failure"},
+							map[string]interface{}{"name": "Error", "value": "something went wrong"},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "webhook error status fails",
+			args: args{
+				format:     NotificationFormatJSON,
+				statusCode: http.StatusInternalServerError,
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown format fails",
+			args: args{
+				format:     "wololo",
+				statusCode: http.StatusOK,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotPayload map[string]interface{}
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				assert.Equal(t, http.MethodPost, req.Method)
+				assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+				body, err := ioutil.ReadAll(req.Body)
+				assert.Nil(t, err)
+				assert.Nil(t, json.Unmarshal(body, &gotPayload))
+				w.WriteHeader(tt.args.statusCode)
+			}))
+			defer ts.Close()
+
+			err := SendNotification(ts.Client(), ts.URL, tt.args.format, notification)
+			assert.Equal(t, tt.wantErr, err != nil)
+			if tt.wantErr {
+				return
+			}
+			assert.Equal(t, tt.wantPayload, gotPayload)
+		})
+	}
+}
+
+func TestSendNotificationToUnreachableWebhook(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	webhookURL := ts.URL
+	ts.Close()
+
+	err := SendNotification(http.DefaultClient, webhookURL, NotificationFormatJSON, Notification{})
+	assert.NotNil(t, err)
+}
+
+func TestNotify(t *testing.T) {
+	var notifiedTimes int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		notifiedTimes++
+	}))
+	defer ts.Close()
+	downTs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	downTs.Close()
+
+	viper.Set("notify-webhook", []string{downTs.URL, ts.URL})
+	viper.Set("notify-format", NotificationFormatSlack)
+	viper.Set("notify-timeout", time.Second)
+	defer viper.Reset()
+
+	// Unreachable webhooks do not prevent notifying the rest of them
+	Notify(NewNotification(NotificationActionRemove, "mystack", "primary", time.Now(), errors.New("something went wrong")))
+	assert.Equal(t, 1, notifiedTimes)
+}
@@ -0,0 +1,31 @@
+package common
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Confirm asks the user a yes/no question through the standard input and
+// returns true only if the answer is "y" or "yes" (case insensitive)
+func Confirm(question string) (confirmed bool, err error) {
+	fmt.Printf("%s [y/N]: ", question)
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err == io.EOF {
+		// Input was closed, use whatever was read so far
+		fmt.Println()
+		err = nil
+	} else if err != nil {
+		return
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		confirmed = true
+	}
+
+	return
+}
@@ -0,0 +1,170 @@
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// StackFileExtensionKey is the top-level stack file key holding the stack
+// deployment metadata. Docker ignores top-level keys starting with "x-".
+const StackFileExtensionKey = "x-psu"
+
+// StackFileExtension represents the stack deployment metadata in a stack
+// file's x-psu block
+type StackFileExtension struct {
+	// Endpoint is the name of the endpoint to deploy the stack to
+	Endpoint string `yaml:"endpoint"`
+	// Env holds default values for the stack environment variables
+	Env map[string]string `yaml:"env"`
+	// Access is the stack access control mode (admins, private or public)
+	Access string `yaml:"access"`
+	// Prune tells whether services no longer referenced should be pruned
+	Prune *bool `yaml:"prune"`
+	// PsuVersion is the psu version required to deploy the stack, like ">=1.1.0" or ">=1.1.0, <2.0.0"
+	PsuVersion string `yaml:"psu-version"`
+}
+
+// GetStackFileExtension returns the x-psu block of a stack file (if any)
+func GetStackFileExtension(content string) (extension StackFileExtension, found bool, err error) {
+	var document yaml.MapSlice
+	err = yaml.Unmarshal([]byte(content), &document)
+	if err != nil {
+		err = fmt.Errorf("invalid stack file: %s", err)
+		return
+	}
+
+	value, found := getYAMLMapValue(document, StackFileExtensionKey)
+	if !found {
+		return
+	}
+	valueBytes, err := yaml.Marshal(value)
+	if err != nil {
+		return
+	}
+	err = yaml.UnmarshalStrict(valueBytes, &extension)
+	if err != nil {
+		err = fmt.Errorf("invalid %s block in stack file: %s", StackFileExtensionKey, err)
+		return
+	}
+
+	switch extension.Access {
+	case "", "admins", "private", "public":
+	default:
+		err = fmt.Errorf("invalid %s block in stack file: invalid access %q (must be one of admins, private or public)", StackFileExtensionKey, extension.Access)
+	}
+	return
+}
+
+// StripStackFileExtension removes the x-psu block from a stack file. The
+// stack file content is returned as it is when it has no such block.
+func StripStackFileExtension(content string) (strippedContent string, err error) {
+	strippedContent = content
+
+	var document yaml.MapSlice
+	err = yaml.Unmarshal([]byte(content), &document)
+	if err != nil {
+		err = fmt.Errorf("invalid stack file: %s", err)
+		return
+	}
+	if _, found := getYAMLMapValue(document, StackFileExtensionKey); !found {
+		return
+	}
+
+	strippedContentBytes, err := yaml.Marshal(deleteYAMLMapValue(document, StackFileExtensionKey))
+	if err != nil {
+		return
+	}
+	strippedContent = string(strippedContentBytes)
+	return
+}
+
+// CheckVersionConstraint checks if a version satisfies a constraint made of
+// one or more comma separated comparisons, like ">=1.1.0, <2.0.0". Supported
+// operators are =, !=, >, >=, < and <=. Versions without an operator are
+// minimum versions (>=).
+func CheckVersionConstraint(version, constraint string) (satisfied bool, err error) {
+	current, err := parseVersion(version)
+	if err != nil {
+		return
+	}
+
+	for _, comparison := range strings.Split(constraint, ",") {
+		comparison = strings.TrimSpace(comparison)
+		operator := ">="
+		for _, candidate := range []string{">=", "<=", "!=", ">", "<", "="} {
+			if strings.HasPrefix(comparison, candidate) {
+				operator = candidate
+				comparison = strings.TrimSpace(strings.TrimPrefix(comparison, candidate))
+				break
+			}
+		}
+		var required []int
+		required, err = parseVersion(comparison)
+		if err != nil {
+			err = fmt.Errorf("invalid version constraint %q: %s", constraint, err)
+			return
+		}
+
+		result := compareVersions(current, required)
+		var matches bool
+		switch operator {
+		case "=":
+			matches = result == 0
+		case "!=":
+			matches = result != 0
+		case ">":
+			matches = result > 0
+		case ">=":
+			matches = result >= 0
+		case "<":
+			matches = result < 0
+		case "<=":
+			matches = result <= 0
+		}
+		if !matches {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// parseVersion parses a version like "v1.2.3" into its major, minor and patch
+// numbers. Missing numbers are zero, and pre-release and build metadata are
+// ignored.
+func parseVersion(version string) (numbers []int, err error) {
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if i := strings.IndexAny(version, "-+"); i >= 0 {
+		version = version[:i]
+	}
+	parts := strings.Split(version, ".")
+	if len(parts) > 3 {
+		err = fmt.Errorf("invalid version %q", version)
+		return
+	}
+	numbers = make([]int, 3)
+	for i, part := range parts {
+		numbers[i], err = strconv.Atoi(part)
+		if err != nil {
+			err = fmt.Errorf("invalid version %q", version)
+			return
+		}
+	}
+	return
+}
+
+// compareVersions returns -1, 0 or 1 if a version is lower, equal or greater
+// than other version
+func compareVersions(a, b []int) int {
+	for i := range a {
+		if a[i] < b[i] {
+			return -1
+		}
+		if a[i] > b[i] {
+			return 1
+		}
+	}
+	return 0
+}
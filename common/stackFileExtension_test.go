@@ -0,0 +1,182 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetStackFileExtension(t *testing.T) {
+	prune := true
+	tests := []struct {
+		name          string
+		content       string
+		wantExtension StackFileExtension
+		wantFound     bool
+		wantErr       bool
+	}{
+		{
+			name: "stack file without x-psu block",
+			content: `version: "3.7"
+services:
+  web:
+    image: nginx
+`,
+		},
+		{
+			name: "stack file with x-psu block",
+			content: `version: "3.7"
+x-psu:
+  endpoint: primary
+  env:
+    REPLICAS: 2
+    MODE: production
+  access: private
+  prune: true
+  psu-version: ">=1.1.0"
+services:
+  web:
+    image: nginx
+`,
+			wantExtension: StackFileExtension{
+				Endpoint: "primary",
+				Env: map[string]string{
+					"REPLICAS": "2",
+					"MODE":     "production",
+				},
+				Access:     "private",
+				Prune:      &prune,
+				PsuVersion: ">=1.1.0",
+			},
+			wantFound: true,
+		},
+		{
+			name: "unknown x-psu fields fail",
+			content: `version: "3.7"
+x-psu:
+  endpoints: primary
+`,
+			wantErr: true,
+		},
+		{
+			name: "invalid access fails",
+			content: `version: "3.7"
+x-psu:
+  access: everyone
+`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotExtension, gotFound, err := GetStackFileExtension(tt.content)
+			assert.Equal(t, tt.wantErr, err != nil)
+			if tt.wantErr {
+				return
+			}
+			assert.Equal(t, tt.wantFound, gotFound)
+			assert.Equal(t, tt.wantExtension, gotExtension)
+		})
+	}
+}
+
+func TestStripStackFileExtension(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		wantContent string
+	}{
+		{
+			name: "stack file without x-psu block is returned as it is",
+			content: `version: "3.7"
+services:
+  web:   # keeps formatting
+    image: nginx
+`,
+			wantContent: `version: "3.7"
+services:
+  web:   # keeps formatting
+    image: nginx
+`,
+		},
+		{
+			name: "x-psu block is removed",
+			content: `version: "3.7"
+x-psu:
+  endpoint: primary
+services:
+  web:
+    image: nginx
+`,
+			wantContent: `version: "3.7"
+services:
+  web:
+    image: nginx
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotContent, err := StripStackFileExtension(tt.content)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.wantContent, gotContent)
+		})
+	}
+}
+
+func TestCheckVersionConstraint(t *testing.T) {
+	tests := []struct {
+		name          string
+		version       string
+		constraint    string
+		wantSatisfied bool
+		wantErr       bool
+	}{
+		{
+			name:          "versions without operator are minimum versions",
+			version:       "1.1.0",
+			constraint:    "1.0",
+			wantSatisfied: true,
+		},
+		{
+			name:          "lower versions do not satisfy minimum versions",
+			version:       "v0.9.3",
+			constraint:    ">=1.0.0",
+			wantSatisfied: false,
+		},
+		{
+			name:          "all comparisons must be satisfied",
+			version:       "2.0.0",
+			constraint:    ">=1.1.0, <2.0.0",
+			wantSatisfied: false,
+		},
+		{
+			name:          "pre-release and build metadata are ignored",
+			version:       "1.2.0-rc1+abc123",
+			constraint:    "=1.2",
+			wantSatisfied: true,
+		},
+		{
+			name:          "excluded versions do not satisfy constraints",
+			version:       "1.2.0",
+			constraint:    ">1.0.0, !=1.2.0",
+			wantSatisfied: false,
+		},
+		{
+			name:       "invalid constraints fail",
+			version:    "1.2.0",
+			constraint: ">=latest",
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotSatisfied, err := CheckVersionConstraint(tt.version, tt.constraint)
+			assert.Equal(t, tt.wantErr, err != nil)
+			if tt.wantErr {
+				return
+			}
+			assert.Equal(t, tt.wantSatisfied, gotSatisfied)
+		})
+	}
+}
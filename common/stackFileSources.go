@@ -0,0 +1,239 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/greenled/portainer-stack-utils/client"
+	portainer "github.com/portainer/portainer/api"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// Docker labels used to identify the configs and secrets created from stack
+// file sources. They are not labelled with the stack namespace, so removing a
+// stack does not remove the sources which may be shared with other stacks
+// (like the stack deployed by "stack bluegreen" to replace it).
+const (
+	StackFileSourceStackLabel = "io.github.greenled.portainer-stack-utils.stack"
+	stackFileSourceHashLabel  = "io.github.greenled.portainer-stack-utils.hash"
+)
+
+// maxStackFileSourceNameLength is the maximum length of Docker config and secret names
+const maxStackFileSourceNameLength = 64
+
+// StackFileSource represents a config or secret created from a local file
+// referenced by a stack file
+type StackFileSource struct {
+	// Type is the Docker resource type (config or secret)
+	Type client.ResourceType
+	// Key is the config or secret key in the stack file
+	Key string
+	// Path is the path to the local file
+	Path string
+	// Name is the content-hashed name of the Docker config or secret
+	Name string
+	// Hash is the hash of the local file content
+	Hash string
+	// Data is the local file content
+	Data []byte
+}
+
+// PrepareStackFileSources reads the local files referenced by a stack file's
+// configs and secrets (relative to the stack file), and rewrites the stack
+// file to reference them as external configs and secrets, named after the
+// stack, their key and a hash of their content (see getStackFileSourceName).
+// The stack file content is returned as it is when it has no such references.
+func PrepareStackFileSources(stackName, stackFilePath, content string, swarm bool) (preparedContent string, sources []StackFileSource, err error) {
+	preparedContent = content
+
+	var document yaml.MapSlice
+	err = yaml.Unmarshal([]byte(content), &document)
+	if err != nil {
+		err = fmt.Errorf("invalid stack file %s: %s", stackFilePath, err)
+		return
+	}
+
+	for _, resourceType := range []client.ResourceType{client.ResourceConfig, client.ResourceSecret} {
+		section := fmt.Sprintf("%ss", resourceType)
+		value, _ := getYAMLMapValue(document, section)
+		definitions, _ := value.(yaml.MapSlice)
+		for i, definition := range definitions {
+			definitionMap, _ := definition.Value.(yaml.MapSlice)
+			path, hasFile := getYAMLMapValue(definitionMap, "file")
+			if !hasFile {
+				continue
+			}
+			if !swarm {
+				err = fmt.Errorf("%s %q in %s is created from a local file, which is only available for Swarm stacks", resourceType, definition.Key, stackFilePath)
+				return
+			}
+
+			source := StackFileSource{
+				Type: resourceType,
+				Key:  fmt.Sprint(definition.Key),
+				Path: fmt.Sprint(path),
+			}
+			if !filepath.IsAbs(source.Path) {
+				source.Path = filepath.Join(filepath.Dir(stackFilePath), source.Path)
+			}
+			source.Data, err = ioutil.ReadFile(source.Path)
+			if err != nil {
+				err = fmt.Errorf("could not read %s %q in %s: %s", resourceType, definition.Key, stackFilePath, err)
+				return
+			}
+			hash := sha256.Sum256(source.Data)
+			source.Hash = hex.EncodeToString(hash[:])
+			source.Name = getStackFileSourceName(stackName, source.Key, source.Hash)
+			sources = append(sources, source)
+
+			definitions[i].Value = getExternalComposeDefinition(document, source.Name)
+		}
+	}
+	if len(sources) == 0 {
+		return
+	}
+
+	preparedContentBytes, err := yaml.Marshal(document)
+	if err != nil {
+		return
+	}
+	preparedContent = string(preparedContentBytes)
+	return
+}
+
+// getStackFileSourceName returns the name of a stack file source, made of
+// the stack name, its key and its content hash. Names too long for Docker
+// have their stack and key part shortened, and a hash of the full part
+// appended to it so they do not collide.
+func getStackFileSourceName(stackName, key, hash string) string {
+	prefix := fmt.Sprintf("%s_%s", stackName, key)
+	name := fmt.Sprintf("%s_%s", prefix, hash[:12])
+	if len(name) <= maxStackFileSourceNameLength {
+		return name
+	}
+
+	prefixHash := sha256.Sum256([]byte(prefix))
+	suffix := fmt.Sprintf("_%s_%s", hex.EncodeToString(prefixHash[:])[:8], hash[:12])
+	return prefix[:maxStackFileSourceNameLength-len(suffix)] + suffix
+}
+
+// getExternalComposeDefinition returns the definition of an external config
+// or secret with a given name, in the format supported by the stack file version
+func getExternalComposeDefinition(document yaml.MapSlice, name string) yaml.MapSlice {
+	version, _ := getYAMLMapValue(document, "version")
+	versionParts := strings.SplitN(fmt.Sprint(version), ".", 2)
+	major, _ := strconv.Atoi(versionParts[0])
+	var minor int
+	if len(versionParts) == 2 {
+		minor, _ = strconv.Atoi(versionParts[1])
+	}
+
+	if major == 3 && minor < 5 {
+		// Naming external configs and secrets is supported since version 3.5
+		return yaml.MapSlice{
+			{Key: "external", Value: yaml.MapSlice{
+				{Key: "name", Value: name},
+			}},
+		}
+	}
+	return yaml.MapSlice{
+		{Key: "name", Value: name},
+		{Key: "external", Value: true},
+	}
+}
+
+// CreateStackFileSources creates the configs and secrets for a stack's file
+// sources in an endpoint. Sources which already exist are left untouched, as
+// their names change along with their content.
+func CreateStackFileSources(endpointID portainer.EndpointID, stackName string, sources []StackFileSource) (err error) {
+	portainerClient, err := GetClient()
+	if err != nil {
+		return
+	}
+
+	for _, source := range sources {
+		logrus.WithFields(logrus.Fields{
+			string(source.Type): source.Name,
+			"stack":             stackName,
+		}).Debug(fmt.Sprintf("Creating stack %s", source.Type))
+		err = portainerClient.DoJSONWithToken(fmt.Sprintf("endpoints/%d/docker/%ss/create", endpointID, source.Type), http.MethodPost, http.Header{}, map[string]interface{}{
+			"Name": source.Name,
+			"Labels": map[string]string{
+				StackFileSourceStackLabel: stackName,
+				stackFileSourceHashLabel:  source.Hash,
+			},
+			"Data": base64.StdEncoding.EncodeToString(source.Data),
+		}, nil)
+		if IsConflictError(err) {
+			logrus.WithFields(logrus.Fields{
+				string(source.Type): source.Name,
+				"stack":             stackName,
+			}).Debug(fmt.Sprintf("Stack %s already exists", source.Type))
+			err = nil
+			continue
+		} else if err != nil {
+			err = fmt.Errorf("could not create %s %s: %s", source.Type, source.Name, err)
+			return
+		}
+		logrus.WithFields(logrus.Fields{
+			string(source.Type): source.Name,
+			"stack":             stackName,
+		}).Info(fmt.Sprintf("Stack %s created", source.Type))
+	}
+
+	return
+}
+
+// RemoveUnusedStackFileSources removes the configs and secrets created for a
+// stack's file sources which are no longer referenced by it. Failures are
+// logged as warnings, as unused sources may still be in use by tasks being
+// torn down, and will be removed in the next deployment.
+func RemoveUnusedStackFileSources(endpointID portainer.EndpointID, stackName string, sources []StackFileSource) {
+	usedSources := map[string]bool{}
+	for _, source := range sources {
+		usedSources[fmt.Sprintf("%s/%s", source.Type, source.Name)] = true
+	}
+
+	for _, resourceType := range []client.ResourceType{client.ResourceConfig, client.ResourceSecret} {
+		logrus.WithFields(logrus.Fields{
+			"stack": stackName,
+		}).Debug(fmt.Sprintf("Getting stack %ss created from local files", resourceType))
+		resources, err := GetDockerResources(endpointID, resourceType, fmt.Sprintf("%s=%s", StackFileSourceStackLabel, stackName))
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"stack":        stackName,
+				"message":      err.Error(),
+				"implications": fmt.Sprintf("Unused stack %ss were not removed", resourceType),
+			}).Warning(fmt.Sprintf("Stack %ss could not be retrieved", resourceType))
+			continue
+		}
+
+		for _, resource := range resources {
+			if usedSources[fmt.Sprintf("%s/%s", resourceType, resource.Name)] {
+				continue
+			}
+			err = RemoveDockerResource(endpointID, resourceType, resource.ID)
+			if err != nil {
+				logrus.WithFields(logrus.Fields{
+					string(resourceType): resource.Name,
+					"stack":              stackName,
+					"message":            err.Error(),
+					"implications":       "It will be removed in the next deployment",
+				}).Warning(fmt.Sprintf("Unused stack %s could not be removed", resourceType))
+				continue
+			}
+			logrus.WithFields(logrus.Fields{
+				string(resourceType): resource.Name,
+				"stack":              stackName,
+			}).Info(fmt.Sprintf("Unused stack %s removed", resourceType))
+		}
+	}
+}
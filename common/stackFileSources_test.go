@@ -0,0 +1,206 @@
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/greenled/portainer-stack-utils/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrepareStackFileSources(t *testing.T) {
+	type args struct {
+		content string
+		swarm   bool
+	}
+	tests := []struct {
+		name        string
+		args        args
+		wantContent string
+		wantSources []StackFileSource
+		wantErr     bool
+	}{
+		{
+			name: "stack file without local sources is returned as it is",
+			args: args{
+				content: `version: "3.7"
+services:
+  web:
+    image: nginx
+configs:
+  nginx_conf:
+    external: true
+`,
+				swarm: true,
+			},
+			wantContent: `version: "3.7"
+services:
+  web:
+    image: nginx
+configs:
+  nginx_conf:
+    external: true
+`,
+		},
+		{
+			name: "local sources are referenced as external by content-hashed names",
+			args: args{
+				content: `version: "3.7"
+services:
+  web:
+    image: nginx
+configs:
+  nginx_conf:
+    file: ./nginx.conf
+secrets:
+  password:
+    file: secrets/password.txt
+`,
+				swarm: true,
+			},
+			wantContent: `version: "3.7"
+services:
+  web:
+    image: nginx
+configs:
+  nginx_conf:
+    name: mystack_nginx_conf_73746ce6cf3d
+    external: true
+secrets:
+  password:
+    name: mystack_password_4e738ca5563c
+    external: true
+`,
+			wantSources: []StackFileSource{
+				{
+					Type: client.ResourceConfig,
+					Key:  "nginx_conf",
+					Path: "nginx.conf",
+					Name: "mystack_nginx_conf_73746ce6cf3d",
+					Hash: "73746ce6cf3d32467233cc02a9c488ac6149a2a9106945849eaf2ff7daad96a6",
+					Data: []byte("worker_processes 1;\n"),
+				},
+				{
+					Type: client.ResourceSecret,
+					Key:  "password",
+					Path: "secrets/password.txt",
+					Name: "mystack_password_4e738ca5563c",
+					Hash: "4e738ca5563c06cfd0018299933d58db1dd8bf97f6973dc99bf6cdc64b5550bd",
+					Data: []byte("s3cr3t"),
+				},
+			},
+		},
+		{
+			name: "local sources are named with the external name syntax in older stack file versions",
+			args: args{
+				content: `version: "3.3"
+configs:
+  nginx_conf:
+    file: nginx.conf
+`,
+				swarm: true,
+			},
+			wantContent: `version: "3.3"
+configs:
+  nginx_conf:
+    external:
+      name: mystack_nginx_conf_73746ce6cf3d
+`,
+			wantSources: []StackFileSource{
+				{
+					Type: client.ResourceConfig,
+					Key:  "nginx_conf",
+					Path: "nginx.conf",
+					Name: "mystack_nginx_conf_73746ce6cf3d",
+					Hash: "73746ce6cf3d32467233cc02a9c488ac6149a2a9106945849eaf2ff7daad96a6",
+					Data: []byte("worker_processes 1;\n"),
+				},
+			},
+		},
+		{
+			name: "local sources fail in non Swarm stacks",
+			args: args{
+				content: `version: "3.7"
+configs:
+  nginx_conf:
+    file: nginx.conf
+`,
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing local sources fail",
+			args: args{
+				content: `version: "3.7"
+configs:
+  nginx_conf:
+    file: missing.conf
+`,
+				swarm: true,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "psu")
+			assert.Nil(t, err)
+			defer os.RemoveAll(dir)
+			assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "nginx.conf"), []byte("worker_processes 1;\n"), 0644))
+			assert.Nil(t, os.Mkdir(filepath.Join(dir, "secrets"), 0755))
+			assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "secrets", "password.txt"), []byte("s3cr3t"), 0644))
+
+			gotContent, gotSources, err := PrepareStackFileSources("mystack", filepath.Join(dir, "stack.yml"), tt.args.content, tt.args.swarm)
+			assert.Equal(t, tt.wantErr, err != nil)
+			if tt.wantErr {
+				return
+			}
+			for i := range tt.wantSources {
+				tt.wantSources[i].Path = filepath.Join(dir, tt.wantSources[i].Path)
+			}
+			assert.Equal(t, tt.wantContent, gotContent)
+			assert.Equal(t, tt.wantSources, gotSources)
+		})
+	}
+}
+
+func Test_getStackFileSourceName(t *testing.T) {
+	type args struct {
+		stackName string
+		key       string
+		hash      string
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{
+			name: "names are made of the stack name, key and content hash",
+			args: args{
+				stackName: "mystack",
+				key:       "nginx_conf",
+				hash:      "73746ce6cf3d32467233cc02a9c488ac6149a2a9106945849eaf2ff7daad96a6",
+			},
+			want: "mystack_nginx_conf_73746ce6cf3d",
+		},
+		{
+			name: "long names are shortened to the Docker limit keeping a hash of their stack name and key",
+			args: args{
+				stackName: "a-very-long-stack-name-used-by-the-platform-team",
+				key:       "nginx_configuration_file",
+				hash:      "73746ce6cf3d32467233cc02a9c488ac6149a2a9106945849eaf2ff7daad96a6",
+			},
+			want: "a-very-long-stack-name-used-by-the-platfor_ee8aed76_73746ce6cf3d",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := getStackFileSourceName(tt.args.stackName, tt.args.key, tt.args.hash)
+			assert.Equal(t, tt.want, got)
+			assert.True(t, len(got) <= maxStackFileSourceNameLength)
+		})
+	}
+}
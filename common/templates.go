@@ -0,0 +1,77 @@
+package common
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	portainer "github.com/portainer/portainer/api"
+)
+
+// GetTemplateEnvironmentVariables validates a set of values against the
+// environment variables declared by an app template, and returns the
+// environment variables to deploy the template with:
+//
+// - Values can only be set for declared variables.
+// - Preset variables can not be overridden, they always take their default value.
+// - Variables with choices only accept one of them, and default to the default choice.
+// - Other variables default to their default value, and are required if they have none.
+func GetTemplateEnvironmentVariables(template portainer.Template, values map[string]string) (variables []portainer.Pair, err error) {
+	declared := map[string]bool{}
+	var missing []string
+	for _, templateEnv := range template.Env {
+		declared[templateEnv.Name] = true
+		value, isSet := values[templateEnv.Name]
+
+		if templateEnv.Preset {
+			if isSet && value != templateEnv.Default {
+				err = fmt.Errorf("environment variable %s is preset by template %q and can not be changed", templateEnv.Name, template.Title)
+				return
+			}
+			value, isSet = templateEnv.Default, true
+		} else if len(templateEnv.Select) > 0 {
+			var choices []string
+			var isChoice bool
+			for _, choice := range templateEnv.Select {
+				choices = append(choices, choice.Value)
+				if !isSet && choice.Default {
+					value, isSet = choice.Value, true
+				}
+				isChoice = isChoice || choice.Value == value
+			}
+			if isSet && !isChoice {
+				err = fmt.Errorf("invalid value %q for environment variable %s of template %q: it must be one of %s", value, templateEnv.Name, template.Title, strings.Join(choices, ", "))
+				return
+			}
+		} else if !isSet && templateEnv.Default != "" {
+			value, isSet = templateEnv.Default, true
+		}
+
+		if !isSet {
+			missing = append(missing, templateEnv.Name)
+			continue
+		}
+		variables = append(variables, portainer.Pair{
+			Name:  templateEnv.Name,
+			Value: value,
+		})
+	}
+
+	var unknown []string
+	for name := range values {
+		if !declared[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		err = fmt.Errorf("environment variables not declared by template %q: %s", template.Title, strings.Join(unknown, ", "))
+		return
+	}
+	if len(missing) > 0 {
+		err = fmt.Errorf("missing required environment variables of template %q: %s", template.Title, strings.Join(missing, ", "))
+		return
+	}
+
+	return
+}
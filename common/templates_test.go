@@ -0,0 +1,108 @@
+package common
+
+import (
+	"testing"
+
+	portainer "github.com/portainer/portainer/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetTemplateEnvironmentVariables(t *testing.T) {
+	template := portainer.Template{
+		Title: "Wordpress",
+		Env: []portainer.TemplateEnv{
+			{
+				Name: "MYSQL_DATABASE_PASSWORD",
+			},
+			{
+				Name:    "WORDPRESS_TITLE",
+				Default: "My blog",
+			},
+			{
+				Name:    "WORDPRESS_VERSION",
+				Default: "5",
+				Preset:  true,
+			},
+			{
+				Name: "WORDPRESS_LOCALE",
+				Select: []portainer.TemplateEnvSelect{
+					{Text: "English", Value: "en_US", Default: true},
+					{Text: "Spanish", Value: "es_ES"},
+				},
+			},
+		},
+	}
+	tests := []struct {
+		name          string
+		values        map[string]string
+		wantVariables []portainer.Pair
+		wantErr       bool
+	}{
+		{
+			name: "defaults are used for variables without values",
+			values: map[string]string{
+				"MYSQL_DATABASE_PASSWORD": "s3cr3t",
+			},
+			wantVariables: []portainer.Pair{
+				{Name: "MYSQL_DATABASE_PASSWORD", Value: "s3cr3t"},
+				{Name: "WORDPRESS_TITLE", Value: "My blog"},
+				{Name: "WORDPRESS_VERSION", Value: "5"},
+				{Name: "WORDPRESS_LOCALE", Value: "en_US"},
+			},
+		},
+		{
+			name: "values override defaults",
+			values: map[string]string{
+				"MYSQL_DATABASE_PASSWORD": "s3cr3t",
+				"WORDPRESS_TITLE":         "Other blog",
+				"WORDPRESS_VERSION":       "5",
+				"WORDPRESS_LOCALE":        "es_ES",
+			},
+			wantVariables: []portainer.Pair{
+				{Name: "MYSQL_DATABASE_PASSWORD", Value: "s3cr3t"},
+				{Name: "WORDPRESS_TITLE", Value: "Other blog"},
+				{Name: "WORDPRESS_VERSION", Value: "5"},
+				{Name: "WORDPRESS_LOCALE", Value: "es_ES"},
+			},
+		},
+		{
+			name:    "variables without value nor default fail",
+			values:  map[string]string{},
+			wantErr: true,
+		},
+		{
+			name: "preset variables can not be overridden",
+			values: map[string]string{
+				"MYSQL_DATABASE_PASSWORD": "s3cr3t",
+				"WORDPRESS_VERSION":       "4",
+			},
+			wantErr: true,
+		},
+		{
+			name: "values not in the variable choices fail",
+			values: map[string]string{
+				"MYSQL_DATABASE_PASSWORD": "s3cr3t",
+				"WORDPRESS_LOCALE":        "fr_FR",
+			},
+			wantErr: true,
+		},
+		{
+			name: "undeclared variables fail",
+			values: map[string]string{
+				"MYSQL_DATABASE_PASSWORD": "s3cr3t",
+				"UNKNOWN":                 "value",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotVariables, err := GetTemplateEnvironmentVariables(template, tt.values)
+			assert.Equal(t, tt.wantErr, err != nil)
+			if tt.wantErr {
+				return
+			}
+			assert.Equal(t, tt.wantVariables, gotVariables)
+		})
+	}
+}
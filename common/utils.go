@@ -20,7 +20,12 @@ const (
 	ErrSeveralEndpointsAvailable = Error("Several endpoints available")
 	ErrNoEndpointsAvailable      = Error("No endpoints available")
 	ErrUserNotFound              = Error("User not found")
+	ErrTeamNotFound              = Error("Team not found")
 	ErrAccessControlNotFound     = Error("Access control not found")
+	ErrEdgeStackNotFound         = Error("Edge stack not found")
+	ErrEdgeGroupNotFound         = Error("Edge group not found")
+	ErrTemplateNotFound          = Error("Template not found")
+	ErrDockerResourceNotFound    = Error("Docker resource not found")
 )
 
 const (
@@ -131,6 +136,62 @@ func GetEndpointGroupByName(name string) (endpointGroup portainer.EndpointGroup,
 	return
 }
 
+// GetEdgeStackByName returns an edge stack by its name from the list of all
+// edge stacks
+func GetEdgeStackByName(name string) (edgeStack client.EdgeStack, err error) {
+	portainerClient, err := GetClient()
+	if err != nil {
+		return
+	}
+
+	edgeStacks, err := portainerClient.EdgeStackList()
+	if err != nil {
+		return
+	}
+
+	for _, edgeStack := range edgeStacks {
+		if edgeStack.Name == name {
+			return edgeStack, nil
+		}
+	}
+	err = ErrEdgeStackNotFound
+	return
+}
+
+// GetEdgeGroupFromListByName returns an edge group by its name from a list of
+// edge groups
+func GetEdgeGroupFromListByName(edgeGroups []client.EdgeGroup, name string) (edgeGroup client.EdgeGroup, err error) {
+	for _, edgeGroup := range edgeGroups {
+		if edgeGroup.Name == name {
+			return edgeGroup, nil
+		}
+	}
+	err = ErrEdgeGroupNotFound
+	return
+}
+
+// GetTemplateByTitle returns an app template by its title from the list of
+// all app templates
+func GetTemplateByTitle(title string) (template portainer.Template, err error) {
+	portainerClient, err := GetClient()
+	if err != nil {
+		return
+	}
+
+	templates, err := portainerClient.TemplateList()
+	if err != nil {
+		return
+	}
+
+	for _, template := range templates {
+		if template.Title == title {
+			return template, nil
+		}
+	}
+	err = ErrTemplateNotFound
+	return
+}
+
 // GetEndpointFromListByID returns an endpoint by its id from a list of
 // endpoints
 func GetEndpointFromListByID(endpoints []portainer.Endpoint, id portainer.EndpointID) (endpoint portainer.Endpoint, err error) {
@@ -244,6 +305,27 @@ func GetUserByName(name string) (user portainer.User, err error) {
 	return
 }
 
+// GetTeamByName returns a team by its name from the list of all teams
+func GetTeamByName(name string) (team portainer.Team, err error) {
+	portainerClient, err := GetClient()
+	if err != nil {
+		return
+	}
+
+	teams, err := portainerClient.TeamList()
+	if err != nil {
+		return
+	}
+
+	for _, team := range teams {
+		if team.Name == name {
+			return team, nil
+		}
+	}
+	err = ErrTeamNotFound
+	return
+}
+
 // GetDockerResourcePortainerAccessControl retrieves a Docker resource's Portainer access control (if any)
 func GetDockerResourcePortainerAccessControl(endpointID portainer.EndpointID, resourceID string, resourceControlType client.ResourceType) (resourceControl portainer.ResourceControl, err error) {
 	portainerClient, err := GetClient()
@@ -7,7 +7,9 @@ require (
 	github.com/mitchellh/go-homedir v1.1.0
 	github.com/portainer/portainer v0.0.0-20190726020158-0b2a76d75a41
 	github.com/sirupsen/logrus v1.4.2
+	github.com/spf13/cast v1.3.0
 	github.com/spf13/cobra v0.0.5
 	github.com/spf13/viper v1.5.0
 	github.com/stretchr/testify v1.2.2
+	gopkg.in/yaml.v2 v2.2.4
 )
@@ -19,6 +19,11 @@ var (
 	buildDate string
 )
 
+// Version returns the tool's version, which is empty for snapshot builds
+func Version() string {
+	return version
+}
+
 // BuildVersionString returns the tool's version
 func BuildVersionString() string {
 	osArch := runtime.GOOS + "/" + runtime.GOARCH